@@ -0,0 +1,183 @@
+// This file is the command-line tool for database migrations. Deploys run
+// `migrate up` before rolling out a new server version; the other commands
+// are for development and the occasional rollback.
+//
+//	migrate up              apply all pending migrations
+//	migrate down [n]        revert the last n migrations (default 1)
+//	migrate status          list migrations and when they were applied
+//	migrate create <name>   add an empty up/down pair to internal/db/migrations
+//	migrate repair [-fix]   report rows that break the schema's constraints,
+//	                        and with -fix delete the ones that can be deleted
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/hi-wesley/mini-youtube/internal/config"
+	"github.com/hi-wesley/mini-youtube/internal/db"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate [-dir path] up | down [n] | status | create <name> | repair [-fix]")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	dir := flag.String("dir", "internal/db/migrations", "migrations directory, used by create")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+
+	// create only writes files, so it doesn't need a database
+	if flag.Arg(0) == "create" {
+		if flag.NArg() != 2 {
+			usage()
+		}
+		if err := create(*dir, flag.Arg(1)); err != nil {
+			log.Fatalf("create: %v", err)
+		}
+		return
+	}
+
+	cfg := config.Load()
+	if err := db.Connect(cfg.DB); err != nil {
+		log.Fatalf("db connect: %v", err)
+	}
+	ctx := context.Background()
+
+	switch flag.Arg(0) {
+	case "up":
+		ran, err := db.MigrateUp(ctx)
+		for _, m := range ran {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("up: %v", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("database is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			n, err := strconv.Atoi(flag.Arg(1))
+			if err != nil || n < 1 {
+				usage()
+			}
+			steps = n
+		}
+		reverted, err := db.MigrateDown(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("down: %v", err)
+		}
+
+	case "status":
+		states, err := db.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("status: %v", err)
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+
+	case "repair":
+		repair(ctx, flag.Args()[1:])
+
+	default:
+		usage()
+	}
+}
+
+// repair reports, and optionally deletes, rows that break constraints.
+func repair(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "delete orphaned and empty rows")
+	fs.Parse(args)
+
+	problems, err := db.CheckIntegrity(ctx)
+	if err != nil {
+		log.Fatalf("repair: %v", err)
+	}
+	if len(problems) == 0 {
+		fmt.Println("no integrity problems found")
+		return
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if !*fix {
+		return
+	}
+
+	deleted, err := db.RepairIntegrity(ctx)
+	if err != nil {
+		log.Fatalf("repair: %v", err)
+	}
+	fmt.Println()
+	for desc, n := range deleted {
+		fmt.Printf("deleted %d %s\n", n, desc)
+	}
+	remaining, err := db.CheckIntegrity(ctx)
+	if err != nil {
+		log.Fatalf("repair: %v", err)
+	}
+	if len(remaining) > 0 {
+		fmt.Println("\nstill needs attention:")
+		for _, p := range remaining {
+			fmt.Println(p)
+		}
+		os.Exit(1)
+	}
+}
+
+var validName = regexp.MustCompile(`^\w+$`)
+
+// create writes the next-numbered pair of empty migration files.
+func create(dir, name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("name must be letters, digits and underscores")
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return err
+	}
+	next := 1
+	for _, f := range existing {
+		var v int
+		if _, err := fmt.Sscanf(filepath.Base(f), "%d_", &v); err == nil && v >= next {
+			next = v + 1
+		}
+	}
+
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(f, "-- %04d_%s (%s)\n", next, name, direction)
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Println("created", path)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,10 +16,17 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	"github.com/hi-wesley/mini-youtube/internal/ai"
 	"github.com/hi-wesley/mini-youtube/internal/config"
 	"github.com/hi-wesley/mini-youtube/internal/db"
 	"github.com/hi-wesley/mini-youtube/internal/handlers"
+	"github.com/hi-wesley/mini-youtube/internal/jobs"
 	"github.com/hi-wesley/mini-youtube/internal/middleware"
+	"github.com/hi-wesley/mini-youtube/internal/moderation"
+	"github.com/hi-wesley/mini-youtube/internal/pipeline"
+	"github.com/hi-wesley/mini-youtube/internal/realtime"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+	"github.com/hi-wesley/mini-youtube/internal/uploads"
 )
 
 func main() {
@@ -27,8 +35,36 @@ func main() {
 	if err := db.Connect(cfg.DB); err != nil {
 		log.Fatalf("db connect: %v", err)
 	}
-	if err := db.AutoMigrate(); err != nil {
-		log.Fatalf("db automigrate: %v", err)
+	// Migrations are normally applied by `migrate up` during deploy. Running
+	// them here too is safe: the advisory lock makes other instances wait.
+	if cfg.MigrateOnStart {
+		if _, err := db.MigrateUp(context.Background()); err != nil {
+			log.Fatalf("db migrate: %v", err)
+		}
+	}
+	if err := storage.Init(context.Background(), cfg); err != nil {
+		log.Fatalf("storage init: %v", err)
+	}
+	defer storage.Store.Close()
+	if err := ai.Init(context.Background(), cfg); err != nil {
+		log.Fatalf("ai init: %v", err)
+	}
+	if ai.Default != nil {
+		defer ai.Default.Close()
+	}
+	if err := moderation.Init(cfg, ai.Default); err != nil {
+		log.Fatalf("moderation: %v", err)
+	}
+
+	// ----- background jobs -----
+	// The pool can also run on its own via cmd/worker; set WORKER_ENABLED=false
+	// to keep the API instances request-only.
+	pipeline.Register()
+	uploads.Register()
+	if cfg.WorkerEnabled {
+		go jobs.Run(context.Background(), jobs.Config{Workers: cfg.WorkerConcurrency})
+	} else {
+		log.Printf("Job worker disabled in this process")
 	}
 
 	// ----- initialize rate limiter -----
@@ -43,6 +79,14 @@ func main() {
 		log.Printf("Rate limiting disabled")
 	}
 
+	// ----- live updates -----
+	// Shares the rate limiter's Redis so comments reach every instance.
+	realtime.Init(middleware.Redis())
+	defer realtime.Default.Close()
+	if err := realtime.InitSocketTickets(cfg.SocketSigningKey); err != nil {
+		log.Fatalf("socket tickets: %v", err)
+	}
+
 	// ----- HTTP router -----
 	router := gin.New()
 	router.RedirectTrailingSlash = true
@@ -72,7 +116,8 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     origins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"},
+		ExposeHeaders:    []string{"Location", "Tus-Resumable", "Tus-Version", "Upload-Offset", "Upload-Length", "Upload-Expires", "X-Object-Name"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -86,21 +131,78 @@ func main() {
 		v1.POST("/auth/register", middleware.RateLimitByIP(6, 24*time.Hour), handlers.RegisterUser)
 
 		// Public video endpoints - daily limits except comments
-		v1.GET("/videos", middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetVideos)
+		v1.GET("/videos", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetVideos)
+		v1.GET("/search", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.SearchVideos)
 		v1.GET("/videos/:id", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetVideo)
-		v1.POST("/videos/:id/view", middleware.RateLimitByIP(480, 24*time.Hour), handlers.IncrementView)
-		v1.GET("/videos/:id/comments", middleware.RateLimitByIP(60, time.Minute), handlers.GetComments)
-		v1.GET("/ws/comments", handlers.CommentsSocket) // WebSocket - handled differently
+		v1.GET("/videos/:id/status", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetVideoStatus)
+		v1.GET("/videos/:id/chapters", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetVideoChapters)
+		v1.GET("/videos/:id/transcript", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetVideoTranscript)
+		v1.POST("/videos/:id/view", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.IncrementView)
+		v1.GET("/users/:username", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetUser)
+		v1.GET("/users/:username/videos", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetUserVideos)
+		v1.GET("/users/:username/playlists", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetUserPlaylists)
+		v1.GET("/playlists/:id", middleware.MaybeAuth(), middleware.RateLimitByIP(480, 24*time.Hour), handlers.GetPlaylist)
+		v1.GET("/videos/:id/comments", middleware.MaybeAuth(), middleware.RateLimitByIP(60, time.Minute), handlers.GetComments)
+		v1.GET("/comments/:id/replies", middleware.MaybeAuth(), middleware.RateLimitByIP(60, time.Minute), handlers.GetReplies)
+		v1.GET("/comments/:id/edits", middleware.MaybeAuth(), middleware.RateLimitByIP(60, time.Minute), handlers.GetCommentEdits)
+		v1.POST("/ws/tickets", middleware.MaybeAuth(), middleware.RateLimitByIP(120, time.Hour), handlers.CreateSocketTicket)
+		v1.GET("/ws/comments", handlers.CommentsSocket) // WebSocket - authenticated by ticket
 
 		// auth-protected endpoints with user-based rate limiting
 		v1.GET("/profile", middleware.Auth(), middleware.RateLimitByUser(60, time.Minute), handlers.GetProfile)
+		v1.PATCH("/profile", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.UpdateProfile)
+		v1.GET("/profile/blocked-terms", middleware.Auth(), middleware.RateLimitByUser(60, time.Minute), handlers.GetBlockedTerms)
+		v1.PUT("/profile/blocked-terms", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.UpdateBlockedTerms)
+		v1.POST("/profile/banner/initiate-upload", middleware.Auth(), middleware.RateLimitByUser(30, 24*time.Hour), handlers.InitiateBannerUpload)
 		v1.POST("/videos/initiate-upload", middleware.Auth(), middleware.RateLimitByUser(30, 24*time.Hour), handlers.InitiateUpload)
+		v1.POST("/uploads", middleware.Auth(), middleware.RateLimitByUser(30, 24*time.Hour), handlers.StartUpload)
+		v1.GET("/uploads/:id", middleware.Auth(), middleware.RateLimitByUser(600, time.Hour), handlers.GetUpload)
+		v1.DELETE("/uploads/:id", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.CancelUpload)
 		v1.POST("/videos/finalize-upload", middleware.Auth(), middleware.RateLimitByUser(30, 24*time.Hour), handlers.FinalizeUpload)
+		v1.PATCH("/videos/:id", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.UpdateVideo)
+		v1.DELETE("/videos/:id", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.DeleteVideo)
+		v1.POST("/videos/:id/restore", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.RestoreVideo)
+		v1.GET("/videos/:id/thumbnails", middleware.Auth(), middleware.RateLimitByUser(60, time.Minute), handlers.GetThumbnails)
+		v1.PUT("/videos/:id/thumbnail", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.SelectThumbnail)
+		v1.POST("/videos/:id/thumbnails/initiate-upload", middleware.Auth(), middleware.RateLimitByUser(30, 24*time.Hour), handlers.InitiateThumbnailUpload)
+		v1.POST("/videos/:id/thumbnails", middleware.Auth(), middleware.RateLimitByUser(30, 24*time.Hour), handlers.CreateThumbnail)
 		v1.POST("/videos/:id/like", middleware.Auth(), middleware.RateLimitByUser(60, 24*time.Hour), handlers.ToggleLike) // Deprecated - kept for backwards compatibility
 		v1.PUT("/videos/:id/like", middleware.Auth(), middleware.RateLimitByUser(60, 24*time.Hour), handlers.CreateLike)
 		v1.DELETE("/videos/:id/like", middleware.Auth(), middleware.RateLimitByUser(60, 24*time.Hour), handlers.RemoveLike)
 		v1.POST("/comments", middleware.Auth(), middleware.RateLimitByUser(30, 24*time.Hour), handlers.CreateComment)
+		v1.PATCH("/comments/:id", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.UpdateComment)
+		v1.DELETE("/comments/:id", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.DeleteComment)
+		v1.GET("/videos/:id/comments/held", middleware.Auth(), middleware.RateLimitByUser(60, time.Minute), handlers.GetHeldComments)
+		v1.POST("/comments/:id/approve", middleware.Auth(), middleware.RateLimitByUser(300, time.Hour), handlers.ApproveComment)
+		v1.POST("/comments/:id/deny", middleware.Auth(), middleware.RateLimitByUser(300, time.Hour), handlers.DenyComment)
+		v1.PUT("/users/:username/subscribe", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.Subscribe)
+		v1.DELETE("/users/:username/subscribe", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.Unsubscribe)
+		v1.GET("/playlists", middleware.Auth(), middleware.RateLimitByUser(60, time.Minute), handlers.GetMyPlaylists)
+		v1.POST("/playlists", middleware.Auth(), middleware.RateLimitByUser(60, 24*time.Hour), handlers.CreatePlaylist)
+		v1.PATCH("/playlists/:id", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.UpdatePlaylist)
+		v1.DELETE("/playlists/:id", middleware.Auth(), middleware.RateLimitByUser(60, time.Hour), handlers.DeletePlaylist)
+		v1.POST("/playlists/:id/items", middleware.Auth(), middleware.RateLimitByUser(600, time.Hour), handlers.AddPlaylistItem)
+		v1.PATCH("/playlists/:id/items/:itemId", middleware.Auth(), middleware.RateLimitByUser(600, time.Hour), handlers.MovePlaylistItem)
+		v1.DELETE("/playlists/:id/items/:itemId", middleware.Auth(), middleware.RateLimitByUser(600, time.Hour), handlers.RemovePlaylistItem)
+		v1.GET("/feed/subscriptions", middleware.Auth(), middleware.RateLimitByUser(600, time.Hour), handlers.GetSubscriptionFeed)
+
+	}
+
+	// local blob store serves its own signed upload/download URLs
+	if local, ok := storage.Store.(*storage.LocalStore); ok {
+		local.RegisterRoutes(router)
+		log.Printf("Serving local blob storage from %s", cfg.LocalStorageDir)
+	}
 
+	// tus endpoint for stores that take chunked uploads through the API.
+	// PATCH is not rate limited per request since a large upload sends many.
+	if _, ok := storage.Store.(storage.Chunked); ok {
+		tus := router.Group("/v1/tus")
+		tus.OPTIONS("", handlers.TusOptions)
+		tus.POST("", middleware.Auth(), middleware.RateLimitByUser(30, 24*time.Hour), handlers.TusCreate)
+		tus.HEAD("/:id", middleware.Auth(), handlers.TusHead)
+		tus.PATCH("/:id", middleware.Auth(), handlers.TusPatch)
+		tus.DELETE("/:id", middleware.Auth(), handlers.TusDelete)
 	}
 
 	// health
@@ -0,0 +1,57 @@
+// This file is the entry point for a standalone background worker. It runs
+// the same job handlers as the API server's built-in pool, without serving
+// the API, so heavy media processing can be scaled separately.
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hi-wesley/mini-youtube/internal/ai"
+	"github.com/hi-wesley/mini-youtube/internal/config"
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/jobs"
+	"github.com/hi-wesley/mini-youtube/internal/pipeline"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+	"github.com/hi-wesley/mini-youtube/internal/uploads"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := config.Load()
+	if err := db.Connect(cfg.DB); err != nil {
+		log.Fatalf("db connect: %v", err)
+	}
+	if err := storage.Init(ctx, cfg); err != nil {
+		log.Fatalf("storage init: %v", err)
+	}
+	defer storage.Store.Close()
+	if err := ai.Init(ctx, cfg); err != nil {
+		log.Fatalf("ai init: %v", err)
+	}
+	if ai.Default != nil {
+		defer ai.Default.Close()
+	}
+
+	// Cloud Run expects something listening on $PORT.
+	if p := os.Getenv("PORT"); p != "" {
+		go func() {
+			http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+			log.Printf("worker health check listening on :%s", p)
+			if err := http.ListenAndServe(":"+p, nil); err != nil {
+				log.Printf("health listener: %v", err)
+			}
+		}()
+	}
+
+	pipeline.Register()
+	uploads.Register()
+	jobs.Run(ctx, jobs.Config{Workers: cfg.WorkerConcurrency})
+	log.Println("worker stopped")
+}
@@ -0,0 +1,276 @@
+// This file asks the summarizer for structured metadata about a video in one
+// go: the summary plus chapters, tags, a content-safety rating and a
+// transcript. Replies are checked against analysisSchema and some common
+// sense, and the model gets another try when they don't pass.
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"github.com/hi-wesley/mini-youtube/internal/config"
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+// maxAttempts is how many replies we accept before giving up on a video.
+const maxAttempts = 3
+
+// ErrMalformed is returned when the model never produced a valid reply.
+var ErrMalformed = errors.New("ai: malformed response")
+
+// Analysis is the structured reply.
+type Analysis struct {
+	Summary  string    `json:"summary"`
+	Chapters []Chapter `json:"chapters"`
+	Tags     []string  `json:"tags"`
+	Safety   Safety    `json:"safety"`
+	Language string    `json:"language"`
+	// Transcript is empty when the provider can't hear the video.
+	Transcript []Segment `json:"transcript"`
+}
+
+type Chapter struct {
+	Start float64 `json:"start"` // seconds
+	Title string  `json:"title"`
+}
+
+type Safety struct {
+	Rating  string   `json:"rating"`
+	Reasons []string `json:"reasons"`
+}
+
+type Segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+var zero = 0.0
+
+var analysisSchema = &Schema{
+	Type:     "object",
+	Required: []string{"summary", "chapters", "tags", "safety", "language", "transcript"},
+	Properties: map[string]*Schema{
+		"summary": {Type: "string", Description: "The summary requested above."},
+		"chapters": {
+			Type:        "array",
+			Description: "Chapters in playback order. Use an empty list for very short videos.",
+			Items: &Schema{
+				Type:     "object",
+				Required: []string{"start", "title"},
+				Properties: map[string]*Schema{
+					"start": {Type: "number", Minimum: &zero, Description: "Start time in seconds."},
+					"title": {Type: "string"},
+				},
+			},
+		},
+		"tags": {
+			Type:        "array",
+			Description: "Up to 10 short lowercase topical tags.",
+			Items:       &Schema{Type: "string"},
+		},
+		"safety": {
+			Type:     "object",
+			Required: []string{"rating", "reasons"},
+			Properties: map[string]*Schema{
+				"rating": {Type: "string", Enum: []string{
+					models.SafetyGeneral, models.SafetyTeen, models.SafetyMature, models.SafetyRestricted,
+				}},
+				"reasons": {Type: "array", Items: &Schema{Type: "string"}},
+			},
+		},
+		"language": {Type: "string", Description: "BCP 47 code of the spoken language, or empty if none."},
+		"transcript": {
+			Type:        "array",
+			Description: "Everything said in the video with timestamps in seconds. Empty if you cannot hear it.",
+			Items: &Schema{
+				Type:     "object",
+				Required: []string{"start", "end", "text"},
+				Properties: map[string]*Schema{
+					"start": {Type: "number", Minimum: &zero},
+					"end":   {Type: "number", Minimum: &zero},
+					"text":  {Type: "string"},
+				},
+			},
+		},
+	},
+}
+
+const analysisInstructions = `
+
+Also break the video into chapters, suggest topical tags, rate how suitable
+it is for a general audience, and transcribe it. Reply with only a JSON
+object matching the provided schema.`
+
+// Analyze asks s about the video and returns a reply that passed validation.
+func Analyze(ctx context.Context, s Summarizer, in *Input) (*Analysis, error) {
+	prompt := in.Prompt + analysisInstructions
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		raw, err := s.Generate(ctx, in, prompt, analysisSchema)
+		if err != nil {
+			// transport and quota errors are the job queue's to retry
+			return nil, err
+		}
+		a, err := parseAnalysis(raw, in.Duration)
+		if err == nil {
+			return a, nil
+		}
+		lastErr = err
+		prompt = in.Prompt + analysisInstructions +
+			fmt.Sprintf("\n\nYour previous reply was rejected: %v. Reply again with only valid JSON.", err)
+	}
+	return nil, fmt.Errorf("%w after %d attempts: %v", ErrMalformed, maxAttempts, lastErr)
+}
+
+// parseAnalysis decodes and validates a reply, tidying what it safely can.
+func parseAnalysis(raw string, duration float64) (*Analysis, error) {
+	raw = stripCodeFence(raw)
+	var generic any
+	if err := json.Unmarshal([]byte(raw), &generic); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if err := analysisSchema.Validate(generic); err != nil {
+		return nil, err
+	}
+	var a Analysis
+	if err := json.Unmarshal([]byte(raw), &a); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	a.Summary = strings.TrimSpace(a.Summary)
+	if a.Summary == "" {
+		return nil, errors.New("summary is empty")
+	}
+	// a little slack for rounding in the model's timestamps
+	limit := duration + 1
+	sort.SliceStable(a.Chapters, func(i, j int) bool { return a.Chapters[i].Start < a.Chapters[j].Start })
+	for i, ch := range a.Chapters {
+		if duration > 0 && ch.Start > limit {
+			return nil, fmt.Errorf("chapter %d starts at %.1fs, after the end of the %.1fs video", i, ch.Start, duration)
+		}
+		a.Chapters[i].Title = truncateRunes(strings.TrimSpace(ch.Title), maxChapterTitle)
+	}
+	for i, seg := range a.Transcript {
+		if seg.End < seg.Start {
+			return nil, fmt.Errorf("transcript segment %d ends before it starts", i)
+		}
+		if duration > 0 && seg.Start > limit {
+			return nil, fmt.Errorf("transcript segment %d starts after the end of the video", i)
+		}
+	}
+	a.Tags = cleanTags(a.Tags)
+	return &a, nil
+}
+
+// maxChapterTitle is the size of models.Chapter.Title.
+const maxChapterTitle = 200
+
+// truncateRunes cuts s to at most n runes.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:n]))
+}
+
+// stripCodeFence removes the ```json fence some models wrap replies in.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimPrefix(s, "json")
+	return strings.TrimSpace(strings.TrimSuffix(s, "```"))
+}
+
+func cleanTags(tags []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(t, "#")))
+		if t == "" || len(t) > 50 || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+		if len(out) == 10 {
+			break
+		}
+	}
+	return out
+}
+
+// AnalyzeAndStore analyzes v with s and replaces whatever was stored for it
+// before: the summary on the video, and its chapters, tags, safety rating and
+// transcript.
+func AnalyzeAndStore(ctx context.Context, s Summarizer, v *models.Video) error {
+	in, err := NewInput(ctx, config.Load(), v)
+	if err != nil {
+		return err
+	}
+	a, err := Analyze(ctx, s, in)
+	if err != nil {
+		return err
+	}
+
+	return db.Conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		analysis := models.VideoAnalysis{
+			VideoID:       v.ID,
+			Model:         s.Model(),
+			SafetyRating:  a.Safety.Rating,
+			SafetyReasons: a.Safety.Reasons,
+			Language:      a.Language,
+		}
+		if err := tx.Save(&analysis).Error; err != nil {
+			return err
+		}
+
+		for _, table := range []any{&models.Chapter{}, &models.VideoTag{}, &models.TranscriptSegment{}} {
+			if err := tx.Where("video_id = ?", v.ID).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		if len(a.Chapters) > 0 {
+			chapters := make([]models.Chapter, len(a.Chapters))
+			for i, ch := range a.Chapters {
+				chapters[i] = models.Chapter{VideoID: v.ID, Position: i, Start: ch.Start, Title: ch.Title}
+			}
+			if err := tx.Create(&chapters).Error; err != nil {
+				return err
+			}
+		}
+		if len(a.Tags) > 0 {
+			tags := make([]models.VideoTag, len(a.Tags))
+			for i, t := range a.Tags {
+				tags[i] = models.VideoTag{VideoID: v.ID, Tag: t}
+			}
+			if err := tx.Create(&tags).Error; err != nil {
+				return err
+			}
+		}
+		if len(a.Transcript) > 0 {
+			segments := make([]models.TranscriptSegment, len(a.Transcript))
+			for i, seg := range a.Transcript {
+				segments[i] = models.TranscriptSegment{VideoID: v.ID, Position: i, Start: seg.Start, End: seg.End, Text: seg.Text}
+			}
+			if err := tx.CreateInBatches(&segments, 200).Error; err != nil {
+				return err
+			}
+		}
+		// Last, so the search trigger on videos sees the new transcript.
+		return tx.Model(&models.Video{}).Where("id = ?", v.ID).Updates(map[string]interface{}{
+			"summary":       a.Summary,
+			"summary_model": s.Model(),
+		}).Error
+	})
+}
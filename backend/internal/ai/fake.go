@@ -0,0 +1,56 @@
+// This file implements a Summarizer that makes no network calls, for local
+// development and tests. The same video always gets the same answer, and
+// comments are only scored as toxic when they say so.
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+// Fake builds a canned analysis from the video's metadata.
+type Fake struct{}
+
+func (Fake) Generate(ctx context.Context, in *Input, prompt string, schema *Schema) (string, error) {
+	if schema == commentSchema {
+		return fakeCommentScore(in.Description)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(in.Title + "\x00" + in.Description))
+
+	a := Analysis{
+		Summary:  fmt.Sprintf("This is a placeholder summary of %q (%.0f seconds, %s). Fingerprint %08x.", in.Title, in.Duration, in.MIMEType, h.Sum32()),
+		Chapters: []Chapter{{Start: 0, Title: "Introduction"}},
+		Tags:     append([]string{}, strings.Fields(strings.ToLower(in.Title))...),
+		Safety:   Safety{Rating: models.SafetyGeneral, Reasons: []string{}},
+		Language: "en",
+		Transcript: []Segment{
+			{Start: 0, End: in.Duration, Text: in.Description},
+		},
+	}
+	if in.Duration >= 60 {
+		a.Chapters = append(a.Chapters, Chapter{Start: in.Duration / 2, Title: "Second half"})
+	}
+	out, err := json.Marshal(a)
+	return string(out), err
+}
+
+// fakeCommentScore flags comments containing "toxic", so the hold and
+// reject paths can be tried out locally.
+func fakeCommentScore(message string) (string, error) {
+	score := CommentScore{Reasons: []string{}}
+	if strings.Contains(strings.ToLower(message), "toxic") {
+		score = CommentScore{Toxicity: 0.95, Reasons: []string{"contains \"toxic\""}}
+	}
+	out, err := json.Marshal(score)
+	return string(out), err
+}
+
+func (Fake) Model() string { return "fake" }
+
+func (Fake) Close() error { return nil }
@@ -0,0 +1,69 @@
+// This file asks the summarizer's model to rate a comment for toxicity, for
+// comment moderation. Unlike video analysis it runs while the commenter
+// waits, so a reply that doesn't validate is an error rather than a reason
+// to ask again; the caller decides what to do without a score.
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CommentScore is the model's rating of a comment.
+type CommentScore struct {
+	// Toxicity runs from 0 (harmless) to 1 (abusive).
+	Toxicity float64  `json:"toxicity"`
+	Reasons  []string `json:"reasons"`
+}
+
+var commentSchema = &Schema{
+	Type:     "object",
+	Required: []string{"toxicity", "reasons"},
+	Properties: map[string]*Schema{
+		"toxicity": {Type: "number", Minimum: &zero, Description: "From 0, harmless, to 1, abusive."},
+		"reasons": {
+			Type:        "array",
+			Description: "Short reasons for a score above 0, such as harassment or hate speech.",
+			Items:       &Schema{Type: "string"},
+		},
+	},
+}
+
+const commentPrompt = `You moderate comments on a video sharing site. Rate how
+toxic the comment below is: insults, harassment, hate speech, threats or
+sexual content aimed at someone. Disagreement, criticism and mild swearing
+are not toxic. Reply with only a JSON object matching the provided schema.
+
+Comment:
+%s`
+
+// ScoreComment asks s to rate a comment. The comment goes in the prompt and
+// in Input.Description; there is no video, so Input.URI is empty.
+func ScoreComment(ctx context.Context, s Summarizer, message string) (*CommentScore, error) {
+	in := &Input{Description: message}
+	raw, err := s.Generate(ctx, in, fmt.Sprintf(commentPrompt, message), commentSchema)
+	if err != nil {
+		return nil, err
+	}
+	raw = stripCodeFence(raw)
+	var generic any
+	if err := json.Unmarshal([]byte(raw), &generic); err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON: %v", ErrMalformed, err)
+	}
+	if err := commentSchema.Validate(generic); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	var score CommentScore
+	if err := json.Unmarshal([]byte(raw), &score); err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON: %v", ErrMalformed, err)
+	}
+	if score.Toxicity > 1 {
+		return nil, fmt.Errorf("%w: toxicity %.2f is above 1", ErrMalformed, score.Toxicity)
+	}
+	for i, r := range score.Reasons {
+		score.Reasons[i] = strings.TrimSpace(r)
+	}
+	return &score, nil
+}
@@ -0,0 +1,96 @@
+// This file implements Summarizer against any server that speaks the OpenAI
+// chat completions API, such as a local llama.cpp or Ollama. Those models
+// generally can't watch video, so they work from the rendered prompt alone;
+// reference {{.URI}} in AI_PROMPT_TEMPLATE if yours can fetch it.
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAI calls POST {endpoint}/chat/completions.
+type OpenAI struct {
+	endpoint string
+	apiKey   string
+	model    string
+	client   *http.Client
+}
+
+func NewOpenAI(endpoint, apiKey, model string) (*OpenAI, error) {
+	if endpoint == "" {
+		return nil, errors.New("AI_ENDPOINT is required for the openai provider")
+	}
+	if model == "" {
+		return nil, errors.New("AI_MODEL is required for the openai provider")
+	}
+	return &OpenAI{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		apiKey:   apiKey,
+		model:    model,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func (o *OpenAI) Generate(ctx context.Context, in *Input, prompt string, schema *Schema) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"model":    o.model,
+		"messages": []chatMessage{{Role: "user", Content: prompt}},
+		// Servers without structured output support ignore this; the reply
+		// is validated either way.
+		"response_format": map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": "video_analysis", "schema": schema},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("chat completion failed: %s: %s", resp.Status, msg)
+	}
+
+	var out struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode chat completion: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+	return out.Choices[0].Message.Content, nil
+}
+
+func (o *OpenAI) Model() string { return o.model }
+
+func (o *OpenAI) Close() error { return nil }
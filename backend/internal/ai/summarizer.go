@@ -1,41 +1,138 @@
+// This file sets up the AI that summarizes each video (see analysis.go for
+// what it's asked). The model behind it is pluggable: Vertex AI Gemini in production, any OpenAI-compatible
+// server (llama.cpp, Ollama, vLLM, ...) for self-hosting, or a fake that needs
+// no network at all. AI_PROVIDER picks one.
 package ai
 
 import (
+	"bytes"
 	"context"
-	"log"
-
-	"cloud.google.com/go/vertexai/genai"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/hi-wesley/mini-youtube/internal/config"
-	"github.com/hi-wesley/mini-youtube/internal/db"
 	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
 )
 
-func GenerateAndCacheSummary(videoID, gcsURI string) {
-	ctx := context.Background()
-	cfg := config.Load()
+// ErrUnsupported is returned when a summarizer can't read the video where
+// it is stored, e.g. Vertex AI with local storage.
+var ErrUnsupported = errors.New("ai: summarizer cannot read this video")
+
+// Input is everything a summarizer gets to know about a video.
+type Input struct {
+	Title       string
+	Description string
+	Duration    float64 // seconds
+	MIMEType    string
+	// URI is where the video can be read: gs://bucket/name on GCS,
+	// otherwise a signed HTTP URL. It is empty for text-only requests
+	// such as ScoreComment.
+	URI string
+	// Prompt is the rendered AI_PROMPT_TEMPLATE.
+	Prompt string
+}
+
+// Summarizer is a model that can look at a video and answer questions
+// about it.
+type Summarizer interface {
+	// Generate sends prompt along with the video in in, and returns the
+	// model's reply, which should be JSON matching schema.
+	Generate(ctx context.Context, in *Input, prompt string, schema *Schema) (string, error)
+	// Model is stored next to the summary so we know what wrote it.
+	Model() string
+	Close() error
+}
+
+// Default is the process-wide summarizer, set up by Init. It is nil when
+// AI_PROVIDER=none.
+var Default Summarizer
 
-	client, err := genai.NewClient(ctx, cfg.ProjectID, cfg.Region)
+// New builds the summarizer selected by AI_PROVIDER.
+func New(ctx context.Context, cfg *config.Config) (Summarizer, error) {
+	switch cfg.AIProvider {
+	case "", "vertex":
+		return NewVertex(ctx, cfg.ProjectID, cfg.Region, orDefault(cfg.AIModel, "gemini-2.5-pro"))
+	case "openai":
+		return NewOpenAI(cfg.AIEndpoint, cfg.AIAPIKey, cfg.AIModel)
+	case "fake":
+		return Fake{}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q", cfg.AIProvider)
+	}
+}
+
+// Init creates the configured summarizer and assigns it to Default.
+func Init(ctx context.Context, cfg *config.Config) error {
+	s, err := New(ctx, cfg)
 	if err != nil {
-		log.Printf("Failed to create genai client: %v", err)
-		return
+		return err
 	}
-	defer client.Close()
+	Default = s
+	return nil
+}
 
-	modelName := "gemini-2.5-pro"
-	model := client.GenerativeModel(modelName)
+// defaultPrompt is used when AI_PROMPT_TEMPLATE is unset. Providers that
+// can't watch the video only have the title and description to go on.
+const defaultPrompt = `Summarize this video in 3 concise sentences.{{if .Title}}
+Title: {{.Title}}{{end}}{{if .Description}}
+Description: {{.Description}}{{end}}`
 
-	resp, err := model.GenerateContent(ctx, genai.FileData{MIMEType: "video/mp4", FileURI: gcsURI}, genai.Text("Summarize this video in 3 concise sentences."))
+// NewInput gathers what the summarizer needs for v and renders the prompt.
+func NewInput(ctx context.Context, cfg *config.Config, v *models.Video) (*Input, error) {
+	in := &Input{
+		Title:       v.Title,
+		Description: v.Description,
+		Duration:    v.Duration,
+		MIMEType:    detectMIME(ctx, cfg, v.ObjectName),
+	}
+	if gcs, ok := storage.Store.(*storage.GCSStore); ok {
+		in.URI = gcs.URI(v.ObjectName)
+	} else {
+		url, err := storage.Store.SignedGetURL(ctx, v.ObjectName, time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		in.URI = url
+	}
+
+	tmpl, err := template.New("prompt").Parse(orDefault(cfg.AIPromptTemplate, defaultPrompt))
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, fmt.Errorf("invalid AI_PROMPT_TEMPLATE: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, in); err != nil {
+		return nil, fmt.Errorf("rendering prompt: %w", err)
+	}
+	in.Prompt = buf.String()
+	return in, nil
+}
+
+// detectMIME uses AI_MIME_TYPE if set, otherwise the file extension, then the
+// content type the object was stored with.
+func detectMIME(ctx context.Context, cfg *config.Config, objectName string) string {
+	if cfg.AIMimeType != "" {
+		return cfg.AIMimeType
+	}
+	if t := mime.TypeByExtension(path.Ext(objectName)); strings.HasPrefix(t, "video/") {
+		return t
+	}
+	if attrs, err := storage.Store.Stat(ctx, objectName); err == nil && strings.HasPrefix(attrs.ContentType, "video/") {
+		return attrs.ContentType
 	}
+	return "video/mp4"
+}
 
-	summary := resp.Candidates[0].Content.Parts[0].(genai.Text)
-	db.Conn.Model(&models.Video{}).
-		Where("id = ?", videoID).
-		Updates(map[string]interface{}{
-			"summary":       string(summary),
-			"summary_model": modelName,
-		})
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
 }
@@ -0,0 +1,55 @@
+// This file implements Summarizer with Gemini on Vertex AI, which watches the
+// video itself by reading it straight from the GCS bucket.
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/vertexai/genai"
+)
+
+// Vertex summarizes videos with a Gemini model.
+type Vertex struct {
+	client *genai.Client
+	model  string
+}
+
+func NewVertex(ctx context.Context, projectID, region, model string) (*Vertex, error) {
+	client, err := genai.NewClient(ctx, projectID, region)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create genai client: %w", err)
+	}
+	return &Vertex{client: client, model: model}, nil
+}
+
+func (v *Vertex) Generate(ctx context.Context, in *Input, prompt string, schema *Schema) (string, error) {
+	// Without a URI there is no video, only text such as a comment to score.
+	parts := []genai.Part{genai.Text(prompt)}
+	if in.URI != "" {
+		if !strings.HasPrefix(in.URI, "gs://") {
+			return "", ErrUnsupported
+		}
+		parts = append([]genai.Part{genai.FileData{MIMEType: in.MIMEType, FileURI: in.URI}}, parts...)
+	}
+	model := v.client.GenerativeModel(v.model)
+	model.ResponseMIMEType = "application/json"
+	model.ResponseSchema = schema.genai()
+	resp, err := model.GenerateContent(ctx, parts...)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("no content in response")
+	}
+	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return "", fmt.Errorf("unexpected response part %T", resp.Candidates[0].Content.Parts[0])
+	}
+	return string(text), nil
+}
+
+func (v *Vertex) Model() string { return v.model }
+
+func (v *Vertex) Close() error { return v.client.Close() }
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -24,6 +25,32 @@ type Config struct {
 	RateLimitEnabled   bool
 	RateLimitRedisURL  string
 	RateLimitRedisDB   int
+	StorageBackend     string // "gcs" or "local"
+	LocalStorageDir    string
+	LocalStorageURL    string // public base URL of this server, used in local signed URLs
+	StorageSigningKey  string
+	SocketSigningKey   string // signs websocket connection tickets; shared by all instances
+	WorkerEnabled      bool   // run the job worker pool inside cmd/server
+	WorkerConcurrency  int
+	MaxUploadBytes     int64
+	MaxVideoDuration   time.Duration
+	QuarantineRejected bool          // move rejected uploads to quarantine/ instead of deleting them
+	UploadSessionTTL   time.Duration // how long an idle resumable upload is kept
+	AIProvider         string        // "vertex", "openai", "fake" or "none"
+	AIModel            string
+	AIEndpoint         string // base URL of an OpenAI-compatible API
+	AIAPIKey           string
+	AIPromptTemplate   string        // text/template over ai.Input
+	AIMimeType         string        // overrides MIME detection for the uploaded video
+	MigrateOnStart     bool          // apply pending migrations when cmd/server starts
+	VideoRestoreWindow time.Duration // how long a deleted video can be restored before it is purged
+	AdminUIDs          []string      // Firebase UIDs allowed to moderate any channel's comments
+	// Comment moderation, see internal/moderation.
+	ModerationBlocklist   string  // path to a file of blocked words and /regexps/
+	ModerationMaxLinks    int     // comments with more links are held for review; -1 for no limit
+	ModerationAI          bool    // also score comments with the AI provider
+	ModerationHoldScore   float64 // AI toxicity score from which comments are held
+	ModerationRejectScore float64 // and from which they are rejected
 }
 
 var (
@@ -44,28 +71,120 @@ func Load() *Config {
 			}
 		}
 
+		workerConcurrency := 2
+		if s := os.Getenv("WORKER_CONCURRENCY"); s != "" {
+			if n, err := strconv.Atoi(s); err == nil && n > 0 {
+				workerConcurrency = n
+			}
+		}
+
+		maxUploadBytes := int64(100 << 20) // 100MB, the limit advertised to users
+		if s := os.Getenv("MAX_UPLOAD_BYTES"); s != "" {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+				maxUploadBytes = n
+			}
+		}
+		maxVideoDuration := 15 * time.Minute
+		if s := os.Getenv("MAX_VIDEO_DURATION"); s != "" {
+			if d, err := time.ParseDuration(s); err == nil && d > 0 {
+				maxVideoDuration = d
+			}
+		}
+
+		uploadSessionTTL := 24 * time.Hour
+		if s := os.Getenv("UPLOAD_SESSION_TTL"); s != "" {
+			if d, err := time.ParseDuration(s); err == nil && d > 0 {
+				uploadSessionTTL = d
+			}
+		}
+
+		videoRestoreWindow := 7 * 24 * time.Hour
+		if s := os.Getenv("VIDEO_RESTORE_WINDOW"); s != "" {
+			if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+				videoRestoreWindow = d
+			}
+		}
+
+		moderationMaxLinks := 2
+		if s := os.Getenv("MODERATION_MAX_LINKS"); s != "" {
+			if n, err := strconv.Atoi(s); err == nil && n >= -1 {
+				moderationMaxLinks = n
+			}
+		}
+		moderationHoldScore := envScore("MODERATION_HOLD_SCORE", 0.6)
+		moderationRejectScore := envScore("MODERATION_REJECT_SCORE", 0.9)
+
+		var adminUIDs []string
+		for _, uid := range strings.Split(os.Getenv("ADMIN_UIDS"), ",") {
+			if uid = strings.TrimSpace(uid); uid != "" {
+				adminUIDs = append(adminUIDs, uid)
+			}
+		}
+
 		cfg = &Config{
-			ProjectID:         os.Getenv("GCP_PROJECT"),
-			Region:            os.Getenv("REGION"),
-			GcsBucket:         os.Getenv("GCS_BUCKET"),
-			DB:                strings.Trim(os.Getenv("DB_DSN"), `"`),
-			FirebaseCreds:     os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"),
-			AllowedOrigins:    os.Getenv("ALLOWED_ORIGINS"),
-			RateLimitEnabled:  os.Getenv("RATE_LIMIT_ENABLED") == "true",
-			RateLimitRedisURL: os.Getenv("RATE_LIMIT_REDIS_URL"),
-			RateLimitRedisDB:  redisDB,
+			ProjectID:          os.Getenv("GCP_PROJECT"),
+			Region:             os.Getenv("REGION"),
+			GcsBucket:          os.Getenv("GCS_BUCKET"),
+			DB:                 strings.Trim(os.Getenv("DB_DSN"), `"`),
+			FirebaseCreds:      os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+			AllowedOrigins:     os.Getenv("ALLOWED_ORIGINS"),
+			RateLimitEnabled:   os.Getenv("RATE_LIMIT_ENABLED") == "true",
+			RateLimitRedisURL:  os.Getenv("RATE_LIMIT_REDIS_URL"),
+			RateLimitRedisDB:   redisDB,
+			StorageBackend:     envOr("STORAGE_BACKEND", "gcs"),
+			LocalStorageDir:    envOr("LOCAL_STORAGE_DIR", "./data/blobs"),
+			LocalStorageURL:    envOr("LOCAL_STORAGE_URL", "http://localhost:8080"),
+			StorageSigningKey:  os.Getenv("STORAGE_SIGNING_KEY"),
+			SocketSigningKey:   os.Getenv("SOCKET_SIGNING_KEY"),
+			WorkerEnabled:      os.Getenv("WORKER_ENABLED") != "false",
+			WorkerConcurrency:  workerConcurrency,
+			MaxUploadBytes:     maxUploadBytes,
+			MaxVideoDuration:   maxVideoDuration,
+			QuarantineRejected: os.Getenv("QUARANTINE_REJECTED_UPLOADS") != "false",
+			UploadSessionTTL:   uploadSessionTTL,
+			AIProvider:         envOr("AI_PROVIDER", "vertex"),
+			AIModel:            os.Getenv("AI_MODEL"),
+			AIEndpoint:         envOr("AI_ENDPOINT", "http://localhost:11434/v1"),
+			AIAPIKey:           os.Getenv("AI_API_KEY"),
+			AIPromptTemplate:   os.Getenv("AI_PROMPT_TEMPLATE"),
+			AIMimeType:         os.Getenv("AI_MIME_TYPE"),
+			MigrateOnStart:     os.Getenv("MIGRATE_ON_START") != "false",
+			VideoRestoreWindow: videoRestoreWindow,
+			AdminUIDs:          adminUIDs,
+
+			ModerationBlocklist:   os.Getenv("MODERATION_BLOCKLIST"),
+			ModerationMaxLinks:    moderationMaxLinks,
+			ModerationAI:          os.Getenv("MODERATION_AI") == "true",
+			ModerationHoldScore:   moderationHoldScore,
+			ModerationRejectScore: moderationRejectScore,
 		}
 
-		
 		if cfg.ProjectID == "" {
 			log.Fatal("GCP_PROJECT environment variable is required")
 		}
 		if cfg.DB == "" {
 			log.Fatal("DB_DSN environment variable is required")
 		}
-		if cfg.GcsBucket == "" {
+		if cfg.StorageBackend == "gcs" && cfg.GcsBucket == "" {
 			log.Fatal("GCS_BUCKET environment variable is required")
 		}
 	})
 	return cfg
-}
\ No newline at end of file
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envScore reads a score between 0 and 1, falling back to def.
+func envScore(key string, def float64) float64 {
+	if s := os.Getenv(key); s != "" {
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f >= 0 && f <= 1 {
+			return f
+		}
+	}
+	return def
+}
@@ -0,0 +1,34 @@
+// This file holds the opaque cursors used for keyset pagination. A cursor is
+// just the sort key of the last row a client saw, encoded so clients treat it
+// as a token rather than something to build themselves.
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor is returned for cursors we didn't issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor turns the keyset values of the last row into a cursor.
+func EncodeCursor(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor reads a cursor from EncodeCursor into v.
+func DecodeCursor(cursor string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS "transcript_segments";
+DROP TABLE IF EXISTS "video_tags";
+DROP TABLE IF EXISTS "chapters";
+DROP TABLE IF EXISTS "video_analyses";
+DROP TABLE IF EXISTS "upload_sessions";
+DROP TABLE IF EXISTS "video_steps";
+DROP TABLE IF EXISTS "jobs";
+DROP TABLE IF EXISTS "renditions";
+DROP TABLE IF EXISTS "likes";
+DROP TABLE IF EXISTS "comments";
+DROP TABLE IF EXISTS "videos";
+DROP TABLE IF EXISTS "users";
@@ -0,0 +1,173 @@
+-- Baseline: the schema GORM AutoMigrate produced before versioned migrations.
+-- Everything is IF NOT EXISTS so databases that were auto-migrated can run
+-- it as a no-op and continue from here. Tables that predate video processing
+-- may be missing columns added since, so those are added one by one too.
+
+CREATE TABLE IF NOT EXISTS "users" (
+	"id" text,
+	"email" varchar(255),
+	"username" varchar(50),
+	"avatar_url" text,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users" ("username");
+
+CREATE TABLE IF NOT EXISTS "videos" (
+	"id" text,
+	"user_id" text,
+	"title" varchar(120),
+	"description" text,
+	"thumbnail_url" text,
+	"object_name" text,
+	"summary" text,
+	"summary_model" varchar(50),
+	"views" bigint,
+	"status" varchar(20) NOT NULL DEFAULT 'ready',
+	"failure_reason" text,
+	"duration" decimal,
+	"width" bigint,
+	"height" bigint,
+	"hls_status" varchar(20),
+	"hls_playlist" text,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "fk_videos_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+ALTER TABLE "videos" ADD COLUMN IF NOT EXISTS "status" varchar(20) NOT NULL DEFAULT 'ready';
+ALTER TABLE "videos" ADD COLUMN IF NOT EXISTS "failure_reason" text;
+ALTER TABLE "videos" ADD COLUMN IF NOT EXISTS "duration" decimal;
+ALTER TABLE "videos" ADD COLUMN IF NOT EXISTS "width" bigint;
+ALTER TABLE "videos" ADD COLUMN IF NOT EXISTS "height" bigint;
+ALTER TABLE "videos" ADD COLUMN IF NOT EXISTS "hls_status" varchar(20);
+ALTER TABLE "videos" ADD COLUMN IF NOT EXISTS "hls_playlist" text;
+CREATE INDEX IF NOT EXISTS "idx_videos_status" ON "videos" ("status");
+CREATE INDEX IF NOT EXISTS "idx_videos_user_id" ON "videos" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "comments" (
+	"id" bigserial,
+	"user_id" text,
+	"video_id" text,
+	"message" text,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "fk_videos_comments" FOREIGN KEY ("video_id") REFERENCES "videos"("id"),
+	CONSTRAINT "fk_comments_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_comments_video_id" ON "comments" ("video_id");
+
+CREATE TABLE IF NOT EXISTS "likes" (
+	"user_id" text,
+	"video_id" text,
+	PRIMARY KEY ("user_id", "video_id")
+);
+
+CREATE TABLE IF NOT EXISTS "renditions" (
+	"id" bigserial,
+	"video_id" text,
+	"name" varchar(10),
+	"width" bigint,
+	"height" bigint,
+	"bitrate" bigint,
+	"playlist" text,
+	"status" varchar(20),
+	"error" text,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "fk_videos_renditions" FOREIGN KEY ("video_id") REFERENCES "videos"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_renditions_video_id" ON "renditions" ("video_id");
+
+CREATE TABLE IF NOT EXISTS "jobs" (
+	"id" bigserial,
+	"type" varchar(50),
+	"payload" jsonb NOT NULL DEFAULT '{}',
+	"status" varchar(20) NOT NULL,
+	"run_at" timestamptz NOT NULL,
+	"attempts" bigint NOT NULL DEFAULT 0,
+	"max_attempts" bigint NOT NULL DEFAULT 5,
+	"last_error" text,
+	"unique_key" varchar(200),
+	"locked_by" varchar(100),
+	"locked_at" timestamptz,
+	"finished_at" timestamptz,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_jobs_unique_active" ON "jobs" ("unique_key") WHERE finished_at IS NULL;
+CREATE INDEX IF NOT EXISTS "idx_jobs_runnable" ON "jobs" ("status", "run_at");
+CREATE INDEX IF NOT EXISTS "idx_jobs_type" ON "jobs" ("type");
+
+CREATE TABLE IF NOT EXISTS "video_steps" (
+	"video_id" text,
+	"name" varchar(20),
+	"status" varchar(20),
+	"error" text,
+	"attempts" bigint,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("video_id", "name"),
+	CONSTRAINT "fk_videos_steps" FOREIGN KEY ("video_id") REFERENCES "videos"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "upload_sessions" (
+	"id" text,
+	"user_id" text,
+	"object_name" text,
+	"content_type" text,
+	"size" bigint,
+	"offset" bigint,
+	"protocol" varchar(20),
+	"session_url" text,
+	"status" varchar(20) NOT NULL,
+	"expires_at" timestamptz,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_upload_sessions_expires_at" ON "upload_sessions" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_upload_sessions_status" ON "upload_sessions" ("status");
+CREATE INDEX IF NOT EXISTS "idx_upload_sessions_object_name" ON "upload_sessions" ("object_name");
+CREATE INDEX IF NOT EXISTS "idx_upload_sessions_user_id" ON "upload_sessions" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "video_analyses" (
+	"video_id" text,
+	"model" varchar(50),
+	"safety_rating" varchar(20),
+	"safety_reasons" jsonb,
+	"language" varchar(20),
+	"updated_at" timestamptz,
+	PRIMARY KEY ("video_id"),
+	CONSTRAINT "fk_videos_analysis" FOREIGN KEY ("video_id") REFERENCES "videos"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_video_analyses_safety_rating" ON "video_analyses" ("safety_rating");
+
+CREATE TABLE IF NOT EXISTS "chapters" (
+	"id" bigserial,
+	"video_id" text,
+	"position" bigint,
+	"start" decimal,
+	"title" varchar(200),
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_chapters_video_id" ON "chapters" ("video_id");
+
+CREATE TABLE IF NOT EXISTS "video_tags" (
+	"video_id" text,
+	"tag" varchar(50),
+	PRIMARY KEY ("video_id", "tag"),
+	CONSTRAINT "fk_videos_tags" FOREIGN KEY ("video_id") REFERENCES "videos"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_video_tags_tag" ON "video_tags" ("tag");
+
+CREATE TABLE IF NOT EXISTS "transcript_segments" (
+	"id" bigserial,
+	"video_id" text,
+	"position" bigint,
+	"start" decimal,
+	"end" decimal,
+	"text" text,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_transcript_segments_video_id" ON "transcript_segments" ("video_id");
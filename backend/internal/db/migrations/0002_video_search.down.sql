@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_videos_search_vector;
+DROP TRIGGER IF EXISTS videos_search_vector ON videos;
+DROP FUNCTION IF EXISTS videos_search_vector_update();
+ALTER TABLE videos DROP COLUMN IF EXISTS search_vector;
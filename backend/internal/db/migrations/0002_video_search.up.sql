@@ -0,0 +1,25 @@
+-- Full-text search over videos. search_vector is rebuilt by a trigger from
+-- the title, summary, description and transcript, weighted in that order.
+-- Run scripts/reindex_search.go to fill it for rows that existed before.
+
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION videos_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(NEW.summary, '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C') ||
+		setweight(to_tsvector('english', left(coalesce(
+			(SELECT string_agg(text, ' ' ORDER BY position) FROM transcript_segments WHERE video_id = NEW.id),
+			''), 200000)), 'D');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS videos_search_vector ON videos;
+CREATE TRIGGER videos_search_vector
+	BEFORE INSERT OR UPDATE OF title, description, summary ON videos
+	FOR EACH ROW EXECUTE FUNCTION videos_search_vector_update();
+
+CREATE INDEX IF NOT EXISTS idx_videos_search_vector ON videos USING GIN (search_vector);
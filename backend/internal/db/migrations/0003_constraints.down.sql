@@ -0,0 +1,38 @@
+ALTER TABLE jobs DROP CONSTRAINT IF EXISTS chk_jobs_attempts;
+ALTER TABLE upload_sessions DROP CONSTRAINT IF EXISTS chk_upload_sessions_offset;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS chk_comments_message;
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS chk_videos_status;
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS chk_videos_duration;
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS chk_videos_views;
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS chk_videos_title;
+DROP INDEX IF EXISTS idx_videos_object_name;
+DROP INDEX IF EXISTS idx_users_username_lower;
+
+ALTER TABLE upload_sessions DROP CONSTRAINT IF EXISTS fk_upload_sessions_user;
+ALTER TABLE upload_sessions ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE transcript_segments DROP CONSTRAINT IF EXISTS fk_transcript_segments_video;
+ALTER TABLE transcript_segments ALTER COLUMN video_id DROP NOT NULL;
+ALTER TABLE chapters DROP CONSTRAINT IF EXISTS fk_chapters_video;
+ALTER TABLE chapters ALTER COLUMN video_id DROP NOT NULL;
+ALTER TABLE video_tags DROP CONSTRAINT IF EXISTS fk_video_tags_video;
+ALTER TABLE video_analyses DROP CONSTRAINT IF EXISTS fk_video_analyses_video;
+ALTER TABLE video_steps DROP CONSTRAINT IF EXISTS fk_video_steps_video;
+ALTER TABLE renditions DROP CONSTRAINT IF EXISTS fk_renditions_video;
+ALTER TABLE renditions ALTER COLUMN video_id DROP NOT NULL;
+ALTER TABLE likes DROP CONSTRAINT IF EXISTS fk_likes_video;
+ALTER TABLE likes DROP CONSTRAINT IF EXISTS fk_likes_user;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_user;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_video;
+ALTER TABLE comments ALTER COLUMN video_id DROP NOT NULL;
+ALTER TABLE comments ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS fk_videos_user;
+ALTER TABLE videos ALTER COLUMN user_id DROP NOT NULL;
+
+-- the baseline foreign keys
+ALTER TABLE videos ADD CONSTRAINT fk_videos_user FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE comments ADD CONSTRAINT fk_videos_comments FOREIGN KEY (video_id) REFERENCES videos(id);
+ALTER TABLE comments ADD CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE renditions ADD CONSTRAINT fk_videos_renditions FOREIGN KEY (video_id) REFERENCES videos(id);
+ALTER TABLE video_steps ADD CONSTRAINT fk_videos_steps FOREIGN KEY (video_id) REFERENCES videos(id);
+ALTER TABLE video_analyses ADD CONSTRAINT fk_videos_analysis FOREIGN KEY (video_id) REFERENCES videos(id);
+ALTER TABLE video_tags ADD CONSTRAINT fk_videos_tags FOREIGN KEY (video_id) REFERENCES videos(id);
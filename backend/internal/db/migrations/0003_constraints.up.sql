@@ -0,0 +1,66 @@
+-- Foreign keys with ON DELETE behaviour, plus unique and check constraints.
+-- Rows that break them make this migration fail; run `migrate repair` first
+-- to list them and `migrate repair -fix` to delete the ones that can go.
+
+-- Replace the foreign keys AutoMigrate created without ON DELETE.
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS fk_videos_user;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_videos_comments;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_user;
+ALTER TABLE renditions DROP CONSTRAINT IF EXISTS fk_videos_renditions;
+ALTER TABLE video_steps DROP CONSTRAINT IF EXISTS fk_videos_steps;
+ALTER TABLE video_analyses DROP CONSTRAINT IF EXISTS fk_videos_analysis;
+ALTER TABLE video_tags DROP CONSTRAINT IF EXISTS fk_videos_tags;
+
+ALTER TABLE videos ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE videos ADD CONSTRAINT fk_videos_user
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE comments ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE comments ALTER COLUMN video_id SET NOT NULL;
+ALTER TABLE comments ADD CONSTRAINT fk_comments_video
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE;
+ALTER TABLE comments ADD CONSTRAINT fk_comments_user
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE likes ADD CONSTRAINT fk_likes_user
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE likes ADD CONSTRAINT fk_likes_video
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE;
+
+ALTER TABLE renditions ALTER COLUMN video_id SET NOT NULL;
+ALTER TABLE renditions ADD CONSTRAINT fk_renditions_video
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE;
+ALTER TABLE video_steps ADD CONSTRAINT fk_video_steps_video
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE;
+ALTER TABLE video_analyses ADD CONSTRAINT fk_video_analyses_video
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE;
+ALTER TABLE video_tags ADD CONSTRAINT fk_video_tags_video
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE;
+ALTER TABLE chapters ALTER COLUMN video_id SET NOT NULL;
+ALTER TABLE chapters ADD CONSTRAINT fk_chapters_video
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE;
+ALTER TABLE transcript_segments ALTER COLUMN video_id SET NOT NULL;
+ALTER TABLE transcript_segments ADD CONSTRAINT fk_transcript_segments_video
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE;
+
+ALTER TABLE upload_sessions ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE upload_sessions ADD CONSTRAINT fk_upload_sessions_user
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- Usernames are unique regardless of case, which the handlers already assume.
+CREATE UNIQUE INDEX idx_users_username_lower ON users (lower(username));
+-- Finalizing the same upload twice must not create two videos.
+CREATE UNIQUE INDEX idx_videos_object_name ON videos (object_name);
+
+ALTER TABLE videos ADD CONSTRAINT chk_videos_title
+	CHECK (char_length(btrim(title)) BETWEEN 1 AND 120);
+ALTER TABLE videos ADD CONSTRAINT chk_videos_views CHECK (views >= 0);
+ALTER TABLE videos ADD CONSTRAINT chk_videos_duration CHECK (duration >= 0);
+ALTER TABLE videos ADD CONSTRAINT chk_videos_status
+	CHECK (status IN ('uploaded', 'probing', 'processing', 'ready', 'failed'));
+ALTER TABLE comments ADD CONSTRAINT chk_comments_message
+	CHECK (char_length(btrim(message)) > 0);
+ALTER TABLE upload_sessions ADD CONSTRAINT chk_upload_sessions_offset
+	CHECK ("offset" >= 0 AND "offset" <= size);
+ALTER TABLE jobs ADD CONSTRAINT chk_jobs_attempts
+	CHECK (attempts >= 0 AND max_attempts > 0);
@@ -0,0 +1,7 @@
+-- Deleting a video only sets deleted_at. The video disappears from every
+-- listing straight away, its owner can restore it for a while, and the
+-- purge job removes the row and its files once that window has passed.
+
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS idx_videos_deleted_at ON videos (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,25 @@
+-- Thumbnail candidates: frames the pipeline scored plus images uploaded by
+-- the owner. At most one per video is selected; its 640px JPEG is copied to
+-- videos.thumbnail_url for clients that only want a single URL.
+
+CREATE TABLE IF NOT EXISTS thumbnails (
+	id bigserial PRIMARY KEY,
+	video_id text NOT NULL,
+	source varchar(10) NOT NULL,
+	at numeric,
+	base text NOT NULL,
+	width bigint,
+	height bigint,
+	widths jsonb,
+	brightness numeric,
+	entropy numeric,
+	sharpness numeric,
+	score numeric,
+	selected boolean NOT NULL DEFAULT false,
+	created_at timestamptz,
+	CONSTRAINT fk_videos_thumbnails FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	CONSTRAINT chk_thumbnails_source CHECK (source IN ('frame', 'custom'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_thumbnails_video_id ON thumbnails (video_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_thumbnails_selected ON thumbnails (video_id) WHERE selected;
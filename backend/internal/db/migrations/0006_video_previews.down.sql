@@ -0,0 +1,3 @@
+ALTER TABLE videos DROP COLUMN IF EXISTS storyboard_url;
+ALTER TABLE videos DROP COLUMN IF EXISTS preview_webp_url;
+ALTER TABLE videos DROP COLUMN IF EXISTS preview_url;
@@ -0,0 +1,5 @@
+-- Hover previews and the seek-bar storyboard, filled in by the preview step.
+
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS preview_url text;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS preview_webp_url text;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS storyboard_url text;
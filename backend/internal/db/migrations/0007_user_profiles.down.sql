@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS links;
+ALTER TABLE users DROP COLUMN IF EXISTS banner_url;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
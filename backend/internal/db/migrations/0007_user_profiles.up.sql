@@ -0,0 +1,5 @@
+-- Channel page details users can edit on their profile.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS banner_url text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS links jsonb;
@@ -0,0 +1,14 @@
+-- Users following channels. Nobody can subscribe to themselves; the index on
+-- channel_id serves subscriber counts.
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+	subscriber_id text NOT NULL,
+	channel_id text NOT NULL,
+	created_at timestamptz,
+	PRIMARY KEY (subscriber_id, channel_id),
+	CONSTRAINT fk_subscriptions_subscriber FOREIGN KEY (subscriber_id) REFERENCES users(id) ON DELETE CASCADE,
+	CONSTRAINT fk_subscriptions_channel FOREIGN KEY (channel_id) REFERENCES users(id) ON DELETE CASCADE,
+	CONSTRAINT chk_subscriptions_self CHECK (subscriber_id <> channel_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_channel_id ON subscriptions (channel_id);
@@ -0,0 +1,35 @@
+-- Playlists and their items. Each user has at most one Watch later playlist,
+-- which is always private. Items are ordered by a fractional position and a
+-- video appears at most once per playlist.
+
+CREATE TABLE IF NOT EXISTS playlists (
+	id text PRIMARY KEY,
+	user_id text NOT NULL,
+	title varchar(150) NOT NULL,
+	description text,
+	visibility varchar(10) NOT NULL DEFAULT 'private',
+	kind varchar(20) NOT NULL DEFAULT '',
+	created_at timestamptz,
+	updated_at timestamptz,
+	CONSTRAINT fk_playlists_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	CONSTRAINT chk_playlists_title CHECK (char_length(btrim(title)) BETWEEN 1 AND 150),
+	CONSTRAINT chk_playlists_visibility CHECK (visibility IN ('public', 'unlisted', 'private')),
+	CONSTRAINT chk_playlists_kind CHECK (kind IN ('', 'watch_later')),
+	CONSTRAINT chk_playlists_watch_later_private CHECK (kind <> 'watch_later' OR visibility = 'private')
+);
+
+CREATE INDEX IF NOT EXISTS idx_playlists_user_id ON playlists (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_playlists_watch_later ON playlists (user_id) WHERE kind = 'watch_later';
+
+CREATE TABLE IF NOT EXISTS playlist_items (
+	id bigserial PRIMARY KEY,
+	playlist_id text NOT NULL,
+	video_id text NOT NULL,
+	position double precision NOT NULL,
+	created_at timestamptz,
+	CONSTRAINT fk_playlist_items_playlist FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+	CONSTRAINT fk_playlist_items_video FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_playlist_items_video ON playlist_items (playlist_id, video_id);
+CREATE INDEX IF NOT EXISTS idx_playlist_items_position ON playlist_items (playlist_id, position);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_videos_scheduled;
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS chk_videos_publish_at;
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS chk_videos_visibility;
+ALTER TABLE videos DROP COLUMN IF EXISTS publish_at;
+ALTER TABLE videos DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,12 @@
+-- Who can see a video. Existing videos stay public. Scheduled videos need a
+-- publish time; the scheduler flips them to public once it has passed.
+
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS visibility varchar(10) NOT NULL DEFAULT 'public';
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS publish_at timestamptz;
+
+ALTER TABLE videos ADD CONSTRAINT chk_videos_visibility
+	CHECK (visibility IN ('public', 'unlisted', 'private', 'scheduled'));
+ALTER TABLE videos ADD CONSTRAINT chk_videos_publish_at
+	CHECK (visibility <> 'scheduled' OR publish_at IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS idx_videos_scheduled ON videos (publish_at) WHERE visibility = 'scheduled';
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS comment_edits;
+DROP INDEX IF EXISTS idx_comments_top_level;
+DROP INDEX IF EXISTS idx_comments_parent_id;
+-- Deleted comments and replies can't be represented any more.
+DELETE FROM comments WHERE deleted_at IS NOT NULL OR parent_id IS NOT NULL;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS chk_comments_message;
+ALTER TABLE comments ADD CONSTRAINT chk_comments_message
+	CHECK (char_length(btrim(message)) > 0);
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_parent;
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS edited_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,27 @@
+-- Replies, edits and deletes for comments. A reply belongs to the same video
+-- as its parent. Deleted comments that still have replies keep their row with
+-- an empty message; comment_edits holds the text each edit replaced.
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_id bigint;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS edited_at timestamptz;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+
+ALTER TABLE comments ADD CONSTRAINT fk_comments_parent
+	FOREIGN KEY (parent_id) REFERENCES comments(id) ON DELETE CASCADE;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS chk_comments_message;
+ALTER TABLE comments ADD CONSTRAINT chk_comments_message
+	CHECK (deleted_at IS NOT NULL OR char_length(btrim(message)) > 0);
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_comments_top_level ON comments (video_id, created_at, id) WHERE parent_id IS NULL;
+
+CREATE TABLE IF NOT EXISTS comment_edits (
+	id bigserial PRIMARY KEY,
+	comment_id bigint NOT NULL,
+	message text NOT NULL,
+	created_at timestamptz,
+	CONSTRAINT fk_comment_edits_comment FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_edits_comment_id ON comment_edits (comment_id);
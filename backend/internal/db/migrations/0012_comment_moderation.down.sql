@@ -0,0 +1,7 @@
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_terms;
+DROP INDEX IF EXISTS idx_comments_held;
+-- Held comments would become public without this.
+DELETE FROM comments WHERE status = 'held';
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS chk_comments_status;
+ALTER TABLE comments DROP COLUMN IF EXISTS held_reason;
+ALTER TABLE comments DROP COLUMN IF EXISTS status;
@@ -0,0 +1,15 @@
+-- Comment moderation. Comments that need a look before going public are
+-- saved as held, with the reason, until the video owner or an admin approves
+-- (publishes) or denies (deletes) them. Rejected comments are never saved.
+-- Channel owners keep their own list of blocked terms on users.
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS status varchar(10) NOT NULL DEFAULT 'published';
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS held_reason text;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS chk_comments_status;
+ALTER TABLE comments ADD CONSTRAINT chk_comments_status
+	CHECK (status IN ('published', 'held'));
+
+CREATE INDEX IF NOT EXISTS idx_comments_held ON comments (video_id, created_at, id) WHERE status = 'held';
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_terms jsonb;
@@ -0,0 +1,4 @@
+-- Periodic jobs are enqueued once per time slot, keyed type@slot. Checking
+-- for finished jobs with the key as well as unfinished ones needs an index
+-- covering every row, not just the unfinished ones idx_jobs_unique_active has.
+CREATE INDEX IF NOT EXISTS idx_jobs_unique_key ON jobs (unique_key);
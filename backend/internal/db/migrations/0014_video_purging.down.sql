@@ -0,0 +1,5 @@
+-- Half-purged videos keep deleted_at, so the purge job picks them up again.
+UPDATE videos SET status = 'failed' WHERE status = 'purging';
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS chk_videos_status;
+ALTER TABLE videos ADD CONSTRAINT chk_videos_status
+	CHECK (status IN ('uploaded', 'probing', 'processing', 'ready', 'failed'));
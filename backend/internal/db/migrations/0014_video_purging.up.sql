@@ -0,0 +1,6 @@
+-- The purge job claims a deleted video by moving it to purging before it
+-- removes the files, so a restore that comes in meanwhile can tell the video
+-- is on its way out.
+ALTER TABLE videos DROP CONSTRAINT IF EXISTS chk_videos_status;
+ALTER TABLE videos ADD CONSTRAINT chk_videos_status
+	CHECK (status IN ('uploaded', 'probing', 'processing', 'ready', 'failed', 'purging'));
@@ -0,0 +1,146 @@
+// This file finds rows that break the constraints added in migration 0003:
+// comments and likes pointing at deleted videos or users, empty titles and
+// messages, and duplicates that the unique indexes won't allow. Run it via
+// `migrate repair` before applying that migration to an old database.
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// IntegrityCheck describes one kind of bad row.
+type IntegrityCheck struct {
+	Description string
+	Table       string
+	// Where selects the offending rows of Table.
+	Where string
+	// Key identifies a row in reports.
+	Key string
+	// Fixable checks are repaired by deleting the rows. The rest need a
+	// human to decide, e.g. which of two duplicate usernames to rename.
+	Fixable bool
+}
+
+// videoGone selects the rows of table whose video is missing or has no
+// uploader, so is about to be deleted itself. Before 0003 the foreign keys to
+// videos have no ON DELETE, so a video's rows have to go before it does.
+func videoGone(table string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM videos JOIN users ON users.id = videos.user_id
+		WHERE videos.id = %s.video_id)`, table)
+}
+
+// integrityChecks run in order. The rows of orphaned videos are deleted
+// before the videos themselves (the last fixable check).
+var integrityChecks = []IntegrityCheck{
+	{"upload sessions whose user doesn't exist", "upload_sessions",
+		"user_id IS NULL OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = upload_sessions.user_id)", "id", true},
+	{"comments on videos that don't exist or have no uploader", "comments",
+		videoGone("comments"), "id::text", true},
+	{"comments by users that don't exist", "comments",
+		"user_id IS NULL OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = comments.user_id)", "id::text", true},
+	// Deleted comments that still have replies are kept with no message.
+	// deleted_at is read through to_jsonb because databases older than 0011,
+	// which this mostly runs on, don't have the column.
+	{"empty comments", "comments",
+		"to_jsonb(comments) ->> 'deleted_at' IS NULL AND char_length(btrim(coalesce(message, ''))) = 0", "id::text", true},
+	{"likes of videos that don't exist or have no uploader", "likes",
+		videoGone("likes"), "user_id || '/' || video_id", true},
+	{"likes by users that don't exist", "likes",
+		"NOT EXISTS (SELECT 1 FROM users WHERE users.id = likes.user_id)", "user_id || '/' || video_id", true},
+	{"renditions of videos that don't exist or have no uploader", "renditions",
+		videoGone("renditions"), "id::text", true},
+	{"processing steps of videos that don't exist or have no uploader", "video_steps",
+		videoGone("video_steps"), "video_id || '/' || name", true},
+	{"analyses of videos that don't exist or have no uploader", "video_analyses",
+		videoGone("video_analyses"), "video_id", true},
+	{"tags of videos that don't exist or have no uploader", "video_tags",
+		videoGone("video_tags"), "video_id || '/' || tag", true},
+	{"chapters of videos that don't exist or have no uploader", "chapters",
+		videoGone("chapters"), "id::text", true},
+	{"transcript segments of videos that don't exist or have no uploader", "transcript_segments",
+		videoGone("transcript_segments"), "id::text", true},
+	{"videos whose uploader doesn't exist", "videos",
+		"user_id IS NULL OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = videos.user_id)", "id", true},
+	{"videos with an empty title", "videos",
+		"char_length(btrim(coalesce(title, ''))) = 0", "id", false},
+	{"videos with negative views or duration", "videos",
+		"views < 0 OR duration < 0", "id", false},
+	{"usernames that differ only in case", "users",
+		"EXISTS (SELECT 1 FROM users u WHERE lower(u.username) = lower(users.username) AND u.id <> users.id)", "id || ' ' || username", false},
+	{"videos sharing an object name", "videos",
+		"EXISTS (SELECT 1 FROM videos v WHERE v.object_name = videos.object_name AND v.id <> videos.id)", "id || ' ' || object_name", false},
+}
+
+// IntegrityProblem is a check that found rows.
+type IntegrityProblem struct {
+	IntegrityCheck
+	Count int64
+	// Sample holds the keys of up to ten of the rows.
+	Sample []string
+}
+
+// CheckIntegrity runs every check and returns those that found rows.
+func CheckIntegrity(ctx context.Context) ([]IntegrityProblem, error) {
+	var out []IntegrityProblem
+	for _, check := range integrityChecks {
+		p, err := runCheck(Conn.WithContext(ctx), check)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			out = append(out, *p)
+		}
+	}
+	return out, nil
+}
+
+func runCheck(conn *gorm.DB, check IntegrityCheck) (*IntegrityProblem, error) {
+	p := IntegrityProblem{IntegrityCheck: check}
+	if err := conn.Table(check.Table).Where(check.Where).Count(&p.Count).Error; err != nil {
+		return nil, fmt.Errorf("%s: %w", check.Description, err)
+	}
+	if p.Count == 0 {
+		return nil, nil
+	}
+	err := conn.Table(check.Table).Where(check.Where).Limit(10).Pluck(check.Key, &p.Sample).Error
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", check.Description, err)
+	}
+	return &p, nil
+}
+
+// RepairIntegrity deletes the rows found by fixable checks in a single
+// transaction and returns how many each check removed. Problems that need a
+// decision are left alone; run CheckIntegrity again to see them.
+func RepairIntegrity(ctx context.Context) (map[string]int64, error) {
+	deleted := map[string]int64{}
+	err := Conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, check := range integrityChecks {
+			if !check.Fixable {
+				continue
+			}
+			res := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", check.Table, check.Where))
+			if res.Error != nil {
+				return fmt.Errorf("%s: %w", check.Description, res.Error)
+			}
+			if res.RowsAffected > 0 {
+				deleted[check.Description] = res.RowsAffected
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// String formats a problem for a report.
+func (p IntegrityProblem) String() string {
+	fix := "needs manual repair"
+	if p.Fixable {
+		fix = "deleted by -fix"
+	}
+	return fmt.Sprintf("%d %s (%s): %s", p.Count, p.Description, fix, strings.Join(p.Sample, ", "))
+}
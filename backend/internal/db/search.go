@@ -0,0 +1,37 @@
+// This file holds helpers for full-text search over videos. Each row carries
+// a search_vector column built by a trigger from the title, summary,
+// description and transcript, with a GIN index for fast matching; both are
+// created by migrations/0002_video_search.up.sql.
+package db
+
+import "context"
+
+// SearchConfig is the Postgres text search configuration used for both
+// indexing and queries.
+const SearchConfig = "english"
+
+// ReindexSearch rebuilds search_vector for every video, batchSize rows at a
+// time, by touching the columns the trigger watches. It returns the number of
+// rows updated.
+func ReindexSearch(ctx context.Context, batchSize int) (int64, error) {
+	var total int64
+	lastID := ""
+	for {
+		var ids []string
+		err := Conn.WithContext(ctx).Table("videos").
+			Where("id > ?", lastID).Order("id ASC").Limit(batchSize).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		res := Conn.WithContext(ctx).Exec(`UPDATE videos SET title = title WHERE id IN ?`, ids)
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+		lastID = ids[len(ids)-1]
+	}
+}
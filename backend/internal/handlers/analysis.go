@@ -0,0 +1,61 @@
+// This file serves the structured metadata the AI step extracts from a video:
+// its chapters and transcript. Tags and the safety rating come back with the
+// video itself.
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+// findVisibleVideo loads the video in the URL if the caller may see it,
+// responding with 404 otherwise.
+func findVisibleVideo(c *gin.Context) (*models.Video, bool) {
+	var video models.Video
+	if err := db.Conn.Scopes(visibleTo(c.GetString("uid"))).First(&video, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return nil, false
+	}
+	return &video, true
+}
+
+// GET /v1/videos/:id/chapters
+func GetVideoChapters(c *gin.Context) {
+	video, ok := findVisibleVideo(c)
+	if !ok {
+		return
+	}
+	chapters := []models.Chapter{}
+	if err := db.Conn.Where("video_id = ?", video.ID).Order("position ASC").Find(&chapters).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"videoId":  video.ID,
+		"chapters": chapters,
+	})
+}
+
+// GET /v1/videos/:id/transcript
+func GetVideoTranscript(c *gin.Context) {
+	video, ok := findVisibleVideo(c)
+	if !ok {
+		return
+	}
+	segments := []models.TranscriptSegment{}
+	if err := db.Conn.Where("video_id = ?", video.ID).Order("position ASC").Find(&segments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	var analysis models.VideoAnalysis
+	db.Conn.Limit(1).Find(&analysis, "video_id = ?", video.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"videoId":  video.ID,
+		"language": analysis.Language,
+		"segments": segments,
+	})
+}
@@ -1,159 +1,359 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
 
 	"github.com/hi-wesley/mini-youtube/internal/db"
-	"github.com/hi-wesley/mini-youtube/internal/firebase"
-	"github.com/hi-wesley/mini-youtube/internal/middleware"
 	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/moderation"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true }, // Cloud Run manages TLS/Origins
+// videoVisible reports whether uid may open the video.
+func videoVisible(uid, videoID string) bool {
+	var n int64
+	db.Conn.Model(&models.Video{}).Scopes(visibleTo(uid)).Where("videos.id = ?", videoID).Count(&n)
+	return n > 0
 }
 
-// GET /v1/ws/comments?vid=<videoID>   (Upgrades to WS)
-func CommentsSocket(c *gin.Context) {
-	log.Println("CommentsSocket: new connection")
-	vid := c.Query("vid")
-	if vid == "" {
-		log.Println("CommentsSocket: missing vid")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing vid"})
-		return
+// redactComment hides who wrote a deleted comment.
+func redactComment(cm *models.Comment) {
+	if cm.DeletedAt != nil {
+		cm.UserID = ""
+		cm.User = models.User{}
+		cm.Message = ""
 	}
+}
 
-	tokenStr := c.Query("token")
-	if tokenStr == "" {
-		log.Println("CommentsSocket: missing token")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing token"})
-		return
-	}
+type commentCursor struct {
+	At time.Time `json:"at"`
+	ID uint      `json:"id"`
+}
 
-	token, err := firebase.Client.VerifyIDToken(c, tokenStr)
-	if err != nil {
-		log.Printf("CommentsSocket: invalid token: %v", err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
+// listComments pages through q by creation time and fills in reply counts.
+func listComments(c *gin.Context, q *gorm.DB, desc bool) {
+	limit := 20
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, 100)
 	}
-
-	// Store UID in context for this connection if needed later
-	c.Set("uid", token.UID)
-
-	// Check WebSocket connection limit (1 connection per user per video)
-	allowed, err := middleware.CheckWebSocketLimit(token.UID, vid)
-	if err != nil {
-		log.Printf("CommentsSocket: rate limit check error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "connection limit check failed"})
-		return
+	dir, cmp := "ASC", ">"
+	if desc {
+		dir, cmp = "DESC", "<"
 	}
-	if !allowed {
-		log.Printf("CommentsSocket: connection limit exceeded for user %s on video %s", token.UID, vid)
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "already connected to this video"})
-		return
+	if s := c.Query("cursor"); s != "" {
+		var cur commentCursor
+		if err := db.DecodeCursor(s, &cur); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		q = q.Where("(comments.created_at, comments.id) "+cmp+" (?, ?)", cur.At, cur.ID)
 	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	var comments []models.Comment
+	// one extra row tells us whether there is another page
+	err := q.Preload("User").Order("comments.created_at " + dir + ", comments.id " + dir).Limit(limit + 1).Find(&comments).Error
 	if err != nil {
-		log.Printf("CommentsSocket: upgrade error: %v", err)
-		// Release the connection limit if upgrade fails
-		middleware.ReleaseWebSocketLimit(token.UID, vid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
-	log.Println("CommentsSocket: connection upgraded")
-
-	// Basic pub‑sub: use a channel per video in memory
-	hub := getHub(vid) // see below
-	hub.register <- conn
-	log.Println("CommentsSocket: connection registered")
-
-	// read pump: discard messages (front‑end sends via REST)
-	defer func() {
-		// Release WebSocket connection limit when connection closes
-		middleware.ReleaseWebSocketLimit(token.UID, vid)
-		log.Printf("CommentsSocket: released connection limit for user %s on video %s", token.UID, vid)
-	}()
+	nextCursor := ""
+	if len(comments) > limit {
+		comments = comments[:limit]
+		last := comments[len(comments)-1]
+		nextCursor = db.EncodeCursor(commentCursor{At: last.CreatedAt, ID: last.ID})
+	}
 
-	for {
-		if _, _, err := conn.ReadMessage(); err != nil {
-			log.Printf("CommentsSocket: read error: %v", err)
-			hub.unregister <- conn
-			log.Println("CommentsSocket: connection unregistered")
-			break
+	if len(comments) > 0 {
+		ids := make([]uint, len(comments))
+		for i, cm := range comments {
+			ids[i] = cm.ID
+		}
+		var counts []struct {
+			ParentID uint
+			N        int
+		}
+		db.Conn.Model(&models.Comment{}).Select("parent_id, count(*) AS n").
+			Where("parent_id IN ? AND status = ?", ids, models.CommentPublished).Group("parent_id").Scan(&counts)
+		byID := make(map[uint]int, len(counts))
+		for _, r := range counts {
+			byID[r.ParentID] = r.N
+		}
+		for i := range comments {
+			comments[i].ReplyCount = byID[comments[i].ID]
+			redactComment(&comments[i])
 		}
 	}
-}
 
-type wsHub struct {
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
-	broadcast  chan models.Comment
-	clients    map[*websocket.Conn]struct{}
+	c.JSON(http.StatusOK, gin.H{
+		"comments":   comments,
+		"nextCursor": nextCursor,
+	})
 }
 
-var hubs = make(map[string]*wsHub)
+// GET /v1/videos/:id/comments?sort=&cursor=&limit=
+// Top-level comments, newest first unless sort=oldest, each with its
+// ReplyCount. Replies are fetched per comment.
+func GetComments(c *gin.Context) {
+	if !videoVisible(c.GetString("uid"), c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return
+	}
+	sort := c.DefaultQuery("sort", "newest")
+	if sort != "newest" && sort != "oldest" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be newest or oldest"})
+		return
+	}
+	q := db.Conn.Where("comments.video_id = ? AND comments.parent_id IS NULL AND comments.status = ?", c.Param("id"), models.CommentPublished)
+	listComments(c, q, sort == "newest")
+}
 
-func getHub(videoID string) *wsHub {
-	if h, ok := hubs[videoID]; ok {
-		return h
+// findComment loads the comment in the URL if the caller can see its video
+// and, for a held comment, wrote it or can moderate it.
+func findComment(c *gin.Context) (*models.Comment, bool) {
+	uid := c.GetString("uid")
+	var cm models.Comment
+	err := db.Conn.First(&cm, "id = ?", c.Param("id")).Error
+	if err == nil && !videoVisible(uid, cm.VideoID) {
+		err = gorm.ErrRecordNotFound
 	}
-	h := &wsHub{
-		register: make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
-		broadcast: make(chan models.Comment, 16),
-		clients: make(map[*websocket.Conn]struct{}),
+	if err == nil && cm.Status == models.CommentHeld && cm.UserID != uid && !canModerate(uid, cm.VideoID) {
+		err = gorm.ErrRecordNotFound
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return nil, false
 	}
-	go h.run()
-	hubs[videoID] = h
-	return h
+	return &cm, true
 }
 
-func (h *wsHub) run() {
-	for {
-		select {
-		case c := <-h.register:
-			h.clients[c] = struct{}{}
-		case c := <-h.unregister:
-			delete(h.clients, c); _ = c.Close()
-		case msg := <-h.broadcast:
-			for cli := range h.clients {
-				_ = cli.WriteJSON(msg)
-			}
-		}
+// GET /v1/comments/:id/replies?cursor=&limit=
+// Direct replies to a comment, oldest first, each with its ReplyCount.
+func GetReplies(c *gin.Context) {
+	parent, ok := findComment(c)
+	if !ok {
+		return
 	}
+	listComments(c, db.Conn.Where("comments.parent_id = ? AND comments.status = ?", parent.ID, models.CommentPublished), false)
 }
 
-func GetComments(c *gin.Context) {
-	var comments []models.Comment
-	if err := db.Conn.Preload("User").Where("video_id = ?", c.Param("id")).Order("created_at asc").Find(&comments).Error; err != nil {
+// GET /v1/comments/:id/edits
+// Earlier versions of an edited comment, newest first.
+func GetCommentEdits(c *gin.Context) {
+	cm, ok := findComment(c)
+	if !ok {
+		return
+	}
+	edits := []models.CommentEdit{}
+	if err := db.Conn.Where("comment_id = ?", cm.ID).Order("created_at DESC, id DESC").Find(&edits).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
-	c.JSON(http.StatusOK, comments)
+	c.JSON(http.StatusOK, gin.H{"edits": edits})
 }
 
-// POST /v1/comments  {video_id, message}
+// POST /v1/comments  {video_id, message, parent_id?}
+// The comment is moderated first. Published comments come back with 201,
+// held ones with 202 and are only shown to the video owner until approved,
+// and rejected ones get 422 with the reason and are not saved.
 func CreateComment(c *gin.Context) {
 	uid := c.GetString("uid")
 	var req struct {
-		VideoID string `json:"video_id" binding:"required"`
-		Message string `json:"message" binding:"required"`
+		VideoID  string `json:"video_id" binding:"required"`
+		Message  string `json:"message" binding:"required"`
+		ParentID *uint  `json:"parent_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message must not be empty"})
+		return
+	}
+	if !videoVisible(uid, req.VideoID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return
+	}
+	if req.ParentID != nil {
+		var n int64
+		err := db.Conn.Model(&models.Comment{}).
+			Where("id = ? AND video_id = ? AND deleted_at IS NULL AND status = ?", *req.ParentID, req.VideoID, models.CommentPublished).Count(&n).Error
+		if err != nil {
+			log.Printf("CreateComment: checking parent %d: %v", *req.ParentID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		if n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "parent comment not found"})
+			return
+		}
+	}
+	decision := moderateComment(c, req.VideoID, req.Message)
+	if decision.Outcome == moderation.Reject {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "comment was rejected", "reason": decision.Reason})
+		return
+	}
+	comment := models.Comment{UserID: uid, VideoID: req.VideoID, ParentID: req.ParentID, Message: req.Message, Status: models.CommentPublished}
+	if decision.Outcome == moderation.Hold {
+		comment.Status, comment.HeldReason = models.CommentHeld, decision.Reason
 	}
-	comment := models.Comment{UserID: uid, VideoID: req.VideoID, Message: req.Message}
 	if err := db.Conn.Create(&comment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db"}); return
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db"})
+		return
 	}
 
 	// Eager load user before broadcasting
 	db.Conn.Preload("User").First(&comment, comment.ID)
 
-	getHub(req.VideoID).broadcast <- comment
+	if comment.Status == models.CommentHeld {
+		c.JSON(http.StatusAccepted, comment)
+		return
+	}
+	publishVideoEvent(comment.VideoID, EventCommentCreated, comment)
 	c.JSON(http.StatusCreated, comment)
 }
+
+// PATCH /v1/comments/:id  {message}
+// Author only. The replaced text is kept in the comment's edit history. The
+// new text is moderated like a new comment, but anything short of publish
+// refuses the edit with 422, so an edit can't take a comment out of view.
+func UpdateComment(c *gin.Context) {
+	var req struct {
+		Message string `json:"message" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message must not be empty"})
+		return
+	}
+	cm, ok := findComment(c)
+	if !ok {
+		return
+	}
+	if cm.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+	if cm.UserID != c.GetString("uid") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not your comment"})
+		return
+	}
+
+	if message != cm.Message {
+		if decision := moderateComment(c, cm.VideoID, message); decision.Outcome != moderation.Publish {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "edit was not accepted", "reason": decision.Reason})
+			return
+		}
+		now := time.Now()
+		err := db.Conn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&models.CommentEdit{CommentID: cm.ID, Message: cm.Message, CreatedAt: now}).Error; err != nil {
+				return err
+			}
+			return tx.Model(cm).Updates(map[string]interface{}{"message": message, "edited_at": now}).Error
+		})
+		if err != nil {
+			log.Printf("UpdateComment: %d: %v", cm.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		cm.Message, cm.EditedAt = message, &now
+		db.Conn.Preload("User").First(cm, cm.ID)
+		if cm.Status == models.CommentPublished {
+			publishVideoEvent(cm.VideoID, EventCommentUpdated, *cm)
+		}
+	}
+	c.JSON(http.StatusOK, cm)
+}
+
+// DELETE /v1/comments/:id
+// The author, the video's owner or an admin can delete a comment
+// (idempotent - safe to call multiple times). A comment with replies is
+// blanked rather than removed; one without is removed, along with any
+// deleted ancestors it was the last reply to.
+func DeleteComment(c *gin.Context) {
+	uid := c.GetString("uid")
+	cm, ok := findComment(c)
+	if !ok {
+		return
+	}
+	if cm.UserID != uid && !canModerate(uid, cm.VideoID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not your comment"})
+		return
+	}
+	if cm.DeletedAt != nil {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	now := time.Now()
+	err := db.Conn.Transaction(func(tx *gorm.DB) error {
+		var replies int64
+		if err := tx.Model(&models.Comment{}).Where("parent_id = ?", cm.ID).Count(&replies).Error; err != nil {
+			return err
+		}
+		if replies > 0 {
+			if err := tx.Where("comment_id = ?", cm.ID).Delete(&models.CommentEdit{}).Error; err != nil {
+				return err
+			}
+			return tx.Model(cm).Updates(map[string]interface{}{"message": "", "deleted_at": now}).Error
+		}
+		return deleteCommentRow(tx, cm)
+	})
+	if err != nil {
+		log.Printf("DeleteComment: %d: %v", cm.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	cm.DeletedAt = &now
+	redactComment(cm)
+	if cm.Status == models.CommentPublished {
+		publishVideoEvent(cm.VideoID, EventCommentDeleted, *cm)
+	}
+	c.Status(http.StatusOK)
+}
+
+// deleteCommentRow removes a comment that has no replies, then its parent if
+// that was deleted earlier and is now childless, and so on up the thread.
+func deleteCommentRow(tx *gorm.DB, cm *models.Comment) error {
+	for {
+		if err := tx.Delete(&models.Comment{}, cm.ID).Error; err != nil {
+			return err
+		}
+		if cm.ParentID == nil {
+			return nil
+		}
+		var parent models.Comment
+		err := tx.Where("id = ? AND deleted_at IS NOT NULL", *cm.ParentID).
+			Where("NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = comments.id)").
+			Take(&parent).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cm = &parent
+	}
+}
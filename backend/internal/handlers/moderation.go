@@ -0,0 +1,192 @@
+// This file contains the comment moderation handlers. Comments that the
+// moderation stage held (see internal/moderation) wait in their video's
+// queue until the video owner or an admin (ADMIN_UIDS) approves them, which
+// publishes them as if just posted, or denies them, which deletes them.
+// Channel owners also keep their own list of blocked terms here.
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/moderation"
+)
+
+const (
+	maxBlockedTerms   = 500
+	maxBlockedTermLen = 100
+)
+
+// isAdmin reports whether uid may moderate every channel.
+func isAdmin(uid string) bool {
+	return uid != "" && slices.Contains(cfg.AdminUIDs, uid)
+}
+
+// canModerate reports whether uid may moderate the video's comments: its
+// owner and admins can.
+func canModerate(uid, videoID string) bool {
+	if uid == "" {
+		return false
+	}
+	if isAdmin(uid) {
+		return true
+	}
+	var owns int64
+	db.Conn.Model(&models.Video{}).Where("id = ? AND user_id = ?", videoID, uid).Count(&owns)
+	return owns > 0
+}
+
+// moderateComment runs a comment on the video through the moderator, with
+// the video owner's blocked terms.
+func moderateComment(c *gin.Context, videoID, message string) moderation.Decision {
+	var owner models.User
+	err := db.Conn.Select("blocked_terms").
+		Where("id = (SELECT user_id FROM videos WHERE id = ?)", videoID).Take(&owner).Error
+	if err != nil {
+		log.Printf("moderateComment: blocked terms for %s: %v", videoID, err)
+	}
+	return moderation.Default.Check(c.Request.Context(), message, owner.BlockedTerms)
+}
+
+// GET /v1/videos/:id/comments/held?cursor=&limit=
+// The video's held comments, oldest first, with the reason each was held.
+// Owner and admins only.
+func GetHeldComments(c *gin.Context) {
+	uid := c.GetString("uid")
+	vid := c.Param("id")
+	if !videoVisible(uid, vid) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return
+	}
+	if !canModerate(uid, vid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not your video"})
+		return
+	}
+	q := db.Conn.Where("comments.video_id = ? AND comments.status = ?", vid, models.CommentHeld)
+	listComments(c, q, false)
+}
+
+// findHeldComment loads the comment in the URL for its video's moderators.
+func findHeldComment(c *gin.Context) (*models.Comment, bool) {
+	cm, ok := findComment(c)
+	if !ok {
+		return nil, false
+	}
+	if !canModerate(c.GetString("uid"), cm.VideoID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not your video"})
+		return nil, false
+	}
+	return cm, true
+}
+
+// POST /v1/comments/:id/approve
+// Publishes a held comment (idempotent - safe to call multiple times).
+func ApproveComment(c *gin.Context) {
+	cm, ok := findHeldComment(c)
+	if !ok {
+		return
+	}
+	if cm.Status == models.CommentPublished {
+		c.JSON(http.StatusOK, cm)
+		return
+	}
+	err := db.Conn.Model(cm).Updates(map[string]interface{}{"status": models.CommentPublished, "held_reason": gorm.Expr("NULL")}).Error
+	if err != nil {
+		log.Printf("ApproveComment: %d: %v", cm.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	db.Conn.Preload("User").First(cm, cm.ID)
+	publishVideoEvent(cm.VideoID, EventCommentCreated, *cm)
+	c.JSON(http.StatusOK, cm)
+}
+
+// POST /v1/comments/:id/deny
+// Deletes a held comment. Published comments are removed with DELETE
+// /v1/comments/:id instead.
+func DenyComment(c *gin.Context) {
+	cm, ok := findHeldComment(c)
+	if !ok {
+		return
+	}
+	if cm.Status != models.CommentHeld {
+		c.JSON(http.StatusConflict, gin.H{"error": "comment is not held"})
+		return
+	}
+	// Held comments can't have replies, but their parent may be a deleted
+	// comment waiting for its last reply to go.
+	if err := db.Conn.Transaction(func(tx *gorm.DB) error { return deleteCommentRow(tx, cm) }); err != nil {
+		log.Printf("DenyComment: %d: %v", cm.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// GET /v1/profile/blocked-terms
+// Words and phrases that hold comments on the caller's videos for review.
+func GetBlockedTerms(c *gin.Context) {
+	var u models.User
+	if err := db.Conn.Select("blocked_terms").Take(&u, "id = ?", c.GetString("uid")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	terms := u.BlockedTerms
+	if terms == nil {
+		terms = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"terms": terms})
+}
+
+// PUT /v1/profile/blocked-terms  {terms}
+// Replaces the list. Terms are trimmed and duplicates dropped, ignoring case.
+func UpdateBlockedTerms(c *gin.Context) {
+	var req struct {
+		Terms []string `json:"terms"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Terms == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "terms is required"})
+		return
+	}
+	terms := []string{}
+	seen := map[string]bool{}
+	for _, t := range req.Terms {
+		t = strings.TrimSpace(t)
+		key := strings.ToLower(t)
+		if t == "" || seen[key] {
+			continue
+		}
+		if utf8.RuneCountInString(t) > maxBlockedTermLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "blocked terms must be at most 100 characters"})
+			return
+		}
+		seen[key] = true
+		terms = append(terms, t)
+	}
+	if len(terms) > maxBlockedTerms {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at most 500 blocked terms"})
+		return
+	}
+
+	// Updating through the struct runs the json serializer on BlockedTerms.
+	res := db.Conn.Model(&models.User{ID: c.GetString("uid")}).Select("blocked_terms").
+		Updates(&models.User{BlockedTerms: terms})
+	if res.Error != nil {
+		log.Printf("UpdateBlockedTerms: %v", res.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"terms": terms})
+}
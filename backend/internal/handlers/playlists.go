@@ -0,0 +1,578 @@
+// This file contains the playlist handlers. Users make ordered lists of
+// videos that are public (listed on their channel), unlisted or private, and
+// every user has a private Watch later list that is created the first time it
+// is used and can be addressed as /v1/playlists/watch-later. Items are moved
+// by giving the item they should follow; the new position is the midpoint
+// between its neighbours, and the list is renumbered when the gap gets too
+// small.
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+const (
+	watchLaterID           = "watch-later" // stands in for the caller's Watch later ID in URLs
+	maxPlaylistTitle       = 150
+	maxPlaylistDescription = 5000
+	maxPlaylistItems       = 5000
+	minPositionGap         = 1e-9 // below this the list is renumbered
+)
+
+var errPlaylistFull = errors.New("playlist is full")
+
+func validPlaylistVisibility(v string) bool {
+	return v == models.PlaylistPublic || v == models.PlaylistUnlisted || v == models.PlaylistPrivate
+}
+
+// watchLater returns uid's Watch later playlist, creating it if needed.
+func watchLater(uid string) (*models.Playlist, error) {
+	var pl models.Playlist
+	err := db.Conn.Where("user_id = ? AND kind = ?", uid, models.PlaylistWatchLater).Take(&pl).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &pl, err
+	}
+	pl = models.Playlist{
+		ID:         uuid.NewString(),
+		UserID:     uid,
+		Title:      "Watch later",
+		Visibility: models.PlaylistPrivate,
+		Kind:       models.PlaylistWatchLater,
+	}
+	// Two first requests at once both get here; the unique index keeps one.
+	if err := db.Conn.Clauses(clause.OnConflict{DoNothing: true}).Create(&pl).Error; err != nil {
+		return nil, err
+	}
+	err = db.Conn.Where("user_id = ? AND kind = ?", uid, models.PlaylistWatchLater).Take(&pl).Error
+	return &pl, err
+}
+
+// findPlaylist loads the playlist in the URL if the caller may see it.
+// Private playlists look missing to everyone but their owner.
+func findPlaylist(c *gin.Context) (*models.Playlist, bool) {
+	uid := c.GetString("uid")
+	id := c.Param("id")
+	if id == watchLaterID {
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "sign in to use Watch later"})
+			return nil, false
+		}
+		pl, err := watchLater(uid)
+		if err != nil {
+			log.Printf("findPlaylist: watch later for %s: %v", uid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return nil, false
+		}
+		return pl, true
+	}
+
+	var pl models.Playlist
+	err := db.Conn.First(&pl, "id = ?", id).Error
+	if err == nil && pl.Visibility == models.PlaylistPrivate && pl.UserID != uid {
+		err = gorm.ErrRecordNotFound
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return nil, false
+	}
+	return &pl, true
+}
+
+// ownPlaylist is findPlaylist for changes, which only the owner may make.
+func ownPlaylist(c *gin.Context) (*models.Playlist, bool) {
+	pl, ok := findPlaylist(c)
+	if ok && pl.UserID != c.GetString("uid") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not your playlist"})
+		return nil, false
+	}
+	return pl, ok
+}
+
+// countItems fills ItemCount, counting only videos the caller can see.
+func countItems(uid string, playlists []models.Playlist) error {
+	if len(playlists) == 0 {
+		return nil
+	}
+	ids := make([]string, len(playlists))
+	for i, pl := range playlists {
+		ids[i] = pl.ID
+	}
+	var rows []struct {
+		PlaylistID string
+		N          int
+	}
+	err := db.Conn.Table("playlist_items").
+		Select("playlist_items.playlist_id, count(*) AS n").
+		Joins("JOIN videos ON videos.id = playlist_items.video_id").
+		Scopes(visibleTo(uid)).
+		Where("playlist_items.playlist_id IN ?", ids).
+		Group("playlist_items.playlist_id").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		counts[r.PlaylistID] = r.N
+	}
+	for i := range playlists {
+		playlists[i].ItemCount = counts[playlists[i].ID]
+	}
+	return nil
+}
+
+// POST /v1/playlists  {title, description?, visibility?}
+// New playlists are private unless visibility says otherwise.
+func CreatePlaylist(c *gin.Context) {
+	var req struct {
+		Title       string `json:"title" binding:"required"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+		return
+	}
+	pl := models.Playlist{
+		ID:          uuid.NewString(),
+		UserID:      c.GetString("uid"),
+		Title:       strings.TrimSpace(req.Title),
+		Description: strings.TrimSpace(req.Description),
+		Visibility:  req.Visibility,
+	}
+	if pl.Visibility == "" {
+		pl.Visibility = models.PlaylistPrivate
+	}
+	if msg := checkPlaylist(&pl); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if err := db.Conn.Create(&pl).Error; err != nil {
+		log.Printf("CreatePlaylist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusCreated, pl)
+}
+
+// checkPlaylist returns what is wrong with the editable fields, or "".
+func checkPlaylist(pl *models.Playlist) string {
+	switch {
+	case pl.Title == "" || utf8.RuneCountInString(pl.Title) > maxPlaylistTitle:
+		return "title must be between 1 and 150 characters"
+	case utf8.RuneCountInString(pl.Description) > maxPlaylistDescription:
+		return "description is too long"
+	case !validPlaylistVisibility(pl.Visibility):
+		return "visibility must be public, unlisted or private"
+	}
+	return ""
+}
+
+// GET /v1/playlists
+// The caller's playlists, Watch later first, then the most recently changed.
+func GetMyPlaylists(c *gin.Context) {
+	uid := c.GetString("uid")
+	if _, err := watchLater(uid); err != nil {
+		log.Printf("GetMyPlaylists: watch later for %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	var playlists []models.Playlist
+	err := db.Conn.Where("user_id = ?", uid).
+		Order("kind = 'watch_later' DESC, updated_at DESC").
+		Find(&playlists).Error
+	if err == nil {
+		err = countItems(uid, playlists)
+	}
+	if err != nil {
+		log.Printf("GetMyPlaylists: %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"playlists": playlists})
+}
+
+// GET /v1/users/:username/playlists
+// A channel's public playlists, or all of them for the owner.
+func GetUserPlaylists(c *gin.Context) {
+	u, ok := findUser(c)
+	if !ok {
+		return
+	}
+	uid := c.GetString("uid")
+	q := db.Conn.Where("user_id = ?", u.ID)
+	if uid != u.ID {
+		q = q.Where("visibility = ?", models.PlaylistPublic)
+	}
+	var playlists []models.Playlist
+	err := q.Order("updated_at DESC").Find(&playlists).Error
+	if err == nil {
+		err = countItems(uid, playlists)
+	}
+	if err != nil {
+		log.Printf("GetUserPlaylists: %s: %v", u.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"playlists": playlists})
+}
+
+// GET /v1/playlists/:id
+// The playlist with its videos in order, each with its like count. Videos
+// the caller can't see (deleted, or someone else's still processing) are
+// left out.
+func GetPlaylist(c *gin.Context) {
+	pl, ok := findPlaylist(c)
+	if !ok {
+		return
+	}
+	uid := c.GetString("uid")
+
+	// Anyone with the link sees the owner, so only their public profile.
+	var owner gin.H
+	var u models.User
+	if err := db.Conn.First(&u, "id = ?", pl.UserID).Error; err == nil {
+		owner = publicUser(&u)
+	}
+	var items []models.PlaylistItem
+	err := db.Conn.Select("playlist_items.*").
+		Joins("JOIN videos ON videos.id = playlist_items.video_id").
+		Scopes(visibleTo(uid)).
+		Where("playlist_items.playlist_id = ?", pl.ID).
+		Order("playlist_items.position ASC, playlist_items.id ASC").
+		Preload("Video.User").
+		Find(&items).Error
+	if err != nil {
+		log.Printf("GetPlaylist: %s: %v", pl.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	ids := make([]string, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.VideoID)
+	}
+	likes := map[string]int{}
+	liked := map[string]bool{}
+	if len(ids) > 0 {
+		var rows []struct {
+			VideoID string
+			N       int
+		}
+		db.Conn.Model(&models.Like{}).Select("video_id, count(*) AS n").
+			Where("video_id IN ?", ids).Group("video_id").Scan(&rows)
+		for _, r := range rows {
+			likes[r.VideoID] = r.N
+		}
+		if uid != "" {
+			var likedIDs []string
+			db.Conn.Model(&models.Like{}).Where("user_id = ? AND video_id IN ?", uid, ids).Pluck("video_id", &likedIDs)
+			for _, id := range likedIDs {
+				liked[id] = true
+			}
+		}
+	}
+	for i := range items {
+		if v := items[i].Video; v != nil {
+			v.Likes = likes[v.ID]
+			v.IsLiked = liked[v.ID]
+		}
+	}
+
+	pl.Items = items
+	pl.ItemCount = len(items)
+	c.JSON(http.StatusOK, struct {
+		*models.Playlist
+		User gin.H `json:"User,omitempty"`
+	}{pl, owner})
+}
+
+// PATCH /v1/playlists/:id  {title?, description?, visibility?}
+// Watch later can't be renamed or shared.
+func UpdatePlaylist(c *gin.Context) {
+	var req struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pl, ok := ownPlaylist(c)
+	if !ok {
+		return
+	}
+	if pl.Kind == models.PlaylistWatchLater && (req.Title != nil || req.Visibility != nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Watch later can't be renamed or shared"})
+		return
+	}
+
+	var columns []string
+	if req.Title != nil {
+		pl.Title = strings.TrimSpace(*req.Title)
+		columns = append(columns, "title")
+	}
+	if req.Description != nil {
+		pl.Description = strings.TrimSpace(*req.Description)
+		columns = append(columns, "description")
+	}
+	if req.Visibility != nil {
+		pl.Visibility = *req.Visibility
+		columns = append(columns, "visibility")
+	}
+	if len(columns) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+	if msg := checkPlaylist(pl); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	pl.UpdatedAt = time.Now()
+	columns = append(columns, "updated_at")
+	if err := db.Conn.Model(pl).Select(columns).Updates(pl).Error; err != nil {
+		log.Printf("UpdatePlaylist: %s: %v", pl.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, pl)
+}
+
+// DELETE /v1/playlists/:id
+// Removes the playlist and its items; the videos themselves stay.
+func DeletePlaylist(c *gin.Context) {
+	pl, ok := ownPlaylist(c)
+	if !ok {
+		return
+	}
+	if pl.Kind == models.PlaylistWatchLater {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Watch later can't be deleted"})
+		return
+	}
+	if err := db.Conn.Delete(pl).Error; err != nil {
+		log.Printf("DeletePlaylist: %s: %v", pl.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// lockPlaylist serializes changes to a playlist's items so two moves can't
+// pick the same gap.
+func lockPlaylist(tx *gorm.DB, pl *models.Playlist) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Take(&models.Playlist{}, "id = ?", pl.ID).Error
+}
+
+func touchPlaylist(tx *gorm.DB, pl *models.Playlist) error {
+	return tx.Model(&models.Playlist{}).Where("id = ?", pl.ID).Update("updated_at", time.Now()).Error
+}
+
+// POST /v1/playlists/:id/items  {videoId}
+// Adds a video at the end (idempotent - a video already in the playlist is
+// returned as it is).
+func AddPlaylistItem(c *gin.Context) {
+	var req struct {
+		VideoID string `json:"videoId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "videoId is required"})
+		return
+	}
+	pl, ok := ownPlaylist(c)
+	if !ok {
+		return
+	}
+	uid := c.GetString("uid")
+	var video models.Video
+	if err := db.Conn.Scopes(visibleTo(uid)).Select("id").First(&video, "id = ?", req.VideoID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return
+	}
+
+	var item models.PlaylistItem
+	status := http.StatusCreated
+	err := db.Conn.Transaction(func(tx *gorm.DB) error {
+		if err := lockPlaylist(tx, pl); err != nil {
+			return err
+		}
+		err := tx.Where("playlist_id = ? AND video_id = ?", pl.ID, video.ID).Take(&item).Error
+		if err == nil {
+			status = http.StatusOK
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var last struct {
+			N   int64
+			Max float64
+		}
+		err = tx.Model(&models.PlaylistItem{}).Select("count(*) AS n, coalesce(max(position), 0) AS max").
+			Where("playlist_id = ?", pl.ID).Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		if last.N >= maxPlaylistItems {
+			return errPlaylistFull
+		}
+		item = models.PlaylistItem{PlaylistID: pl.ID, VideoID: video.ID, Position: last.Max + 1}
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return touchPlaylist(tx, pl)
+	})
+	if errors.Is(err, errPlaylistFull) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "playlists can hold at most 5000 videos"})
+		return
+	}
+	if err != nil {
+		log.Printf("AddPlaylistItem: %s: %v", pl.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(status, item)
+}
+
+// PATCH /v1/playlists/:id/items/:itemId  {afterItemId}
+// Moves an item to just after afterItemId, or to the top if it is null.
+func MovePlaylistItem(c *gin.Context) {
+	var req struct {
+		AfterItemID *uint `json:"afterItemId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	itemID, err := strconv.ParseUint(c.Param("itemId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+		return
+	}
+	if req.AfterItemID != nil && uint64(*req.AfterItemID) == itemID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "an item can't follow itself"})
+		return
+	}
+	pl, ok := ownPlaylist(c)
+	if !ok {
+		return
+	}
+
+	var item models.PlaylistItem
+	err = db.Conn.Transaction(func(tx *gorm.DB) error {
+		if err := lockPlaylist(tx, pl); err != nil {
+			return err
+		}
+		if err := tx.Take(&item, "id = ? AND playlist_id = ?", itemID, pl.ID).Error; err != nil {
+			return err
+		}
+		pos, err := positionAfter(tx, pl.ID, item.ID, req.AfterItemID)
+		if err != nil {
+			return err
+		}
+		item.Position = pos
+		if err := tx.Model(&item).Update("position", pos).Error; err != nil {
+			return err
+		}
+		return touchPlaylist(tx, pl)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("MovePlaylistItem: %s: %v", pl.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// positionAfter picks a position between the item afterID (or the start of
+// the list) and the item that follows it, ignoring the item being moved. It
+// renumbers the list first if there is no room left between the two.
+func positionAfter(tx *gorm.DB, playlistID string, movingID uint, afterID *uint) (float64, error) {
+	for attempt := 0; ; attempt++ {
+		var prev *float64
+		if afterID != nil {
+			var after models.PlaylistItem
+			if err := tx.Take(&after, "id = ? AND playlist_id = ?", *afterID, playlistID).Error; err != nil {
+				return 0, err
+			}
+			prev = &after.Position
+		}
+
+		q := tx.Model(&models.PlaylistItem{}).Where("playlist_id = ? AND id <> ?", playlistID, movingID)
+		if prev != nil {
+			q = q.Where("position > ?", *prev)
+		}
+		var next []float64
+		if err := q.Order("position ASC").Limit(1).Pluck("position", &next).Error; err != nil {
+			return 0, err
+		}
+
+		switch {
+		case prev == nil && len(next) == 0:
+			return 1, nil
+		case prev == nil:
+			return next[0] - 1, nil
+		case len(next) == 0:
+			return *prev + 1, nil
+		case next[0]-*prev >= minPositionGap || attempt > 0:
+			return (*prev + next[0]) / 2, nil
+		}
+		err := tx.Exec(`UPDATE playlist_items SET position = r.n
+			FROM (SELECT id, row_number() OVER (ORDER BY position, id) AS n
+				FROM playlist_items WHERE playlist_id = ?) r
+			WHERE playlist_items.id = r.id`, playlistID).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// DELETE /v1/playlists/:id/items/:itemId
+// Removes an item (idempotent - safe to call multiple times).
+func RemovePlaylistItem(c *gin.Context) {
+	itemID, err := strconv.ParseUint(c.Param("itemId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+		return
+	}
+	pl, ok := ownPlaylist(c)
+	if !ok {
+		return
+	}
+	err = db.Conn.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND playlist_id = ?", itemID, pl.ID).Delete(&models.PlaylistItem{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return touchPlaylist(tx, pl)
+	})
+	if err != nil {
+		log.Printf("RemovePlaylistItem: %s: %v", pl.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	// Success whether the item existed or not
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,158 @@
+// This file contains the search handler. It matches the query against the
+// search_vector kept on each video (see internal/db/search.go), ranks the
+// results and pages through them with a cursor.
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+// searchCursor is the keyset of the last result on a page.
+type searchCursor struct {
+	Rank float64 `json:"r"`
+	ID   string  `json:"id"`
+}
+
+type searchHit struct {
+	ID             string
+	Rank           float64
+	TitleHighlight string
+	Snippet        string
+}
+
+// Matches are wrapped in <mark>; the rest of the text is returned as stored,
+// so clients must escape it before rendering as HTML.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \""
+
+// GET /v1/search?q=&uploader=&from=&to=&minDuration=&maxDuration=&cursor=&limit=
+// q uses web search syntax: quoted phrases, OR, and -excluded words.
+func SearchVideos(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit := 20
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, 50)
+	}
+
+	inner := db.Conn.Table("videos").
+		Select(`videos.id,
+			ts_rank_cd(videos.search_vector, query)::float8 AS rank,
+			ts_headline(?, videos.title, query, ?) AS title_highlight,
+			ts_headline(?, coalesce(nullif(videos.summary, ''), videos.description), query, ?) AS snippet`,
+			db.SearchConfig, headlineOptions, db.SearchConfig, headlineOptions).
+		Joins("CROSS JOIN websearch_to_tsquery(?, ?) AS query", db.SearchConfig, q).
+		Where("videos.search_vector @@ query").
+		Scopes(listedTo(c.GetString("uid")))
+
+	if uploader := c.Query("uploader"); uploader != "" {
+		inner = inner.Joins("JOIN users ON users.id = videos.user_id").
+			Where("LOWER(users.username) = LOWER(?) OR users.id = ?", uploader, uploader)
+	}
+	for param, op := range map[string]string{"from": ">=", "to": "<"} {
+		s := c.Query(param)
+		if s == "" {
+			continue
+		}
+		t, err := parseSearchDate(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ", use YYYY-MM-DD or RFC 3339"})
+			return
+		}
+		if param == "to" && len(s) == len("2006-01-02") {
+			t = t.AddDate(0, 0, 1) // a bare date includes the whole day
+		}
+		inner = inner.Where("videos.created_at "+op+" ?", t)
+	}
+	for param, op := range map[string]string{"minDuration": ">=", "maxDuration": "<="} {
+		s := c.Query(param)
+		if s == "" {
+			continue
+		}
+		secs, err := strconv.ParseFloat(s, 64)
+		if err != nil || secs < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ", expected seconds"})
+			return
+		}
+		inner = inner.Where("videos.duration "+op+" ?", secs)
+	}
+
+	outer := db.Conn.Table("(?) AS results", inner)
+	if s := c.Query("cursor"); s != "" {
+		var cur searchCursor
+		if err := db.DecodeCursor(s, &cur); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		outer = outer.Where("rank < ? OR (rank = ? AND id > ?)", cur.Rank, cur.Rank, cur.ID)
+	}
+
+	// one extra row tells us whether there is another page
+	var hits []searchHit
+	if err := outer.Order("rank DESC, id ASC").Limit(limit + 1).Scan(&hits).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	nextCursor := ""
+	if len(hits) > limit {
+		hits = hits[:limit]
+		last := hits[len(hits)-1]
+		nextCursor = db.EncodeCursor(searchCursor{Rank: last.Rank, ID: last.ID})
+	}
+
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	var videos []models.Video
+	if len(ids) > 0 {
+		if err := db.Conn.Preload("User").Where("id IN ?", ids).Find(&videos).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+	byID := make(map[string]models.Video, len(videos))
+	for _, v := range videos {
+		byID[v.ID] = v
+	}
+
+	results := make([]gin.H, 0, len(hits))
+	for _, h := range hits {
+		v, ok := byID[h.ID]
+		if !ok {
+			continue // deleted between the two queries
+		}
+		results = append(results, gin.H{
+			"video":          v,
+			"rank":           h.Rank,
+			"titleHighlight": h.TitleHighlight,
+			"snippet":        h.Snippet,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":    results,
+		"nextCursor": nextCursor,
+	})
+}
+
+func parseSearchDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
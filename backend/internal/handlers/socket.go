@@ -0,0 +1,296 @@
+// This file contains the video websocket. A client opens one socket per video
+// and receives that video's live events through the realtime hub, each
+// wrapped in a versioned {v, type, data} envelope. Every connection has its
+// own write goroutine fed by a bounded queue; a client that stops reading is
+// evicted instead of holding up the others. Ping/pong keeps idle connections
+// open and refreshes the per-user connection limit in Redis and the socket's
+// presence, which is announced to the video's other watchers as it joins and
+// leaves.
+//
+// Sockets are opened with a short-lived ticket from POST /v1/ws/tickets (see
+// realtime/tickets.go) rather than a Firebase token. Logged-out viewers get
+// a ticket too; their sockets are limited per IP instead of per user. Every
+// socket is read-only: clients act through the REST API.
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/hi-wesley/mini-youtube/internal/middleware"
+	"github.com/hi-wesley/mini-youtube/internal/realtime"
+)
+
+// socketProtocol is the subprotocol clients offer alongside their ticket,
+// as in new WebSocket(url, [socketProtocol, ticket]). The server picks it, so
+// the ticket is never echoed back.
+const socketProtocol = "mini-youtube.v1"
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin:  func(r *http.Request) bool { return true }, // Cloud Run manages TLS/Origins
+	Subprotocols: []string{socketProtocol},
+}
+
+const (
+	// socketWriteWait is how long a single write may take.
+	socketWriteWait = 10 * time.Second
+	// socketPongWait is how long the client has to answer a ping.
+	socketPongWait = 60 * time.Second
+	// socketPingPeriod must be shorter than socketPongWait.
+	socketPingPeriod = socketPongWait * 9 / 10
+	// socketMaxMessage caps what clients may send; they only answer pings.
+	socketMaxMessage = 512
+)
+
+// socketVersion is sent as "v" on every event and goes up when the shape of
+// an existing event changes. New event types don't bump it; clients ignore
+// types they don't know.
+const socketVersion = 1
+
+// Events sent over the video websocket.
+const (
+	// data: the comment. Deleted comments carry only their IDs and DeletedAt.
+	EventCommentCreated = "comment.created"
+	EventCommentUpdated = "comment.updated"
+	EventCommentDeleted = "comment.deleted"
+	// data: likeCountEvent
+	EventLikeCount = "video.likes"
+	// data: viewCountEvent
+	EventViewCount = "video.views"
+	// data: presenceEvent
+	EventPresence = "video.presence"
+)
+
+type socketEvent struct {
+	V    int         `json:"v"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// likeCountEvent and viewCountEvent carry the change that caused them and
+// the count after it, so clients can apply the delta or just take the count.
+type likeCountEvent struct {
+	VideoID string `json:"videoId"`
+	Delta   int64  `json:"delta"`
+	Likes   int64  `json:"likes"`
+}
+
+type viewCountEvent struct {
+	VideoID string `json:"videoId"`
+	Delta   int64  `json:"delta"`
+	Views   int64  `json:"views"`
+}
+
+type presenceEvent struct {
+	VideoID  string `json:"videoId"`
+	Watching int64  `json:"watching"`
+}
+
+// videoTopic is the hub topic carrying a video's events.
+func videoTopic(videoID string) string {
+	return "video:" + videoID
+}
+
+// publishVideoEvent sends an event to everyone watching the video. Live
+// updates are best effort, so failures are only logged.
+func publishVideoEvent(videoID, eventType string, data interface{}) {
+	msg, err := json.Marshal(socketEvent{V: socketVersion, Type: eventType, Data: data})
+	if err == nil {
+		err = realtime.Default.Publish(context.Background(), videoTopic(videoID), msg)
+	}
+	if err != nil {
+		log.Printf("publishVideoEvent: %s on %s: %v", eventType, videoID, err)
+	}
+}
+
+// POST /v1/ws/tickets  {videoId}
+// Returns a ticket for opening the video's socket, for the signed-in user if
+// there is one and anonymous otherwise.
+func CreateSocketTicket(c *gin.Context) {
+	var req struct {
+		VideoID string `json:"videoId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "videoId is required"})
+		return
+	}
+	uid := c.GetString("uid")
+	if !videoVisible(uid, req.VideoID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return
+	}
+	ticket, expires, err := realtime.IssueTicket(uid, req.VideoID)
+	if err != nil {
+		log.Printf("CreateSocketTicket: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not issue ticket"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "protocol": socketProtocol, "expiresAt": expires})
+}
+
+// socketTicket finds the ticket in the Sec-WebSocket-Protocol header, next
+// to socketProtocol, or failing that in an Authorization: Bearer header for
+// clients that can set one.
+func socketTicket(r *http.Request) string {
+	for _, p := range websocket.Subprotocols(r) {
+		if p != socketProtocol {
+			return p
+		}
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// GET /v1/ws/comments?vid=<videoID>   (Upgrades to WS; ticket in Sec-WebSocket-Protocol)
+func CommentsSocket(c *gin.Context) {
+	vid := c.Query("vid")
+	if vid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing vid"})
+		return
+	}
+
+	ticket := socketTicket(c.Request)
+	if ticket == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing ticket"})
+		return
+	}
+	uid, err := realtime.VerifyTicket(ticket, vid)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid ticket"})
+		return
+	}
+
+	// Only people who can open the video may follow its events. Checked
+	// again in case it was made private since the ticket was issued.
+	if !videoVisible(uid, vid) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return
+	}
+
+	// Signed-in users get one connection per video; anonymous viewers are
+	// counted per IP across videos.
+	ip := c.ClientIP()
+	check := func() (bool, error) { return middleware.CheckWebSocketLimit(uid, vid) }
+	release := func() error { return middleware.ReleaseWebSocketLimit(uid, vid) }
+	refresh := func() error { return middleware.RefreshWebSocketLimit(uid, vid) }
+	busy := "already connected to this video"
+	if uid == "" {
+		check = func() (bool, error) { return middleware.CheckWebSocketIPLimit(ip) }
+		release = func() error { return middleware.ReleaseWebSocketIPLimit(ip) }
+		refresh = func() error { return middleware.RefreshWebSocketIPLimit(ip) }
+		busy = "too many connections from this address"
+	}
+	allowed, err := check()
+	if err != nil {
+		log.Printf("CommentsSocket: rate limit check error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "connection limit check failed"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": busy})
+		return
+	}
+	defer release()
+
+	sub, err := realtime.Default.Subscribe(videoTopic(vid))
+	if err != nil {
+		log.Printf("CommentsSocket: subscribe error: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "live updates are unavailable"})
+		return
+	}
+	defer sub.Close()
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("CommentsSocket: upgrade error: %v", err)
+		return
+	}
+
+	go writeSocket(conn, sub)
+
+	// Joining after subscribing means this client gets the count too.
+	connID := uuid.NewString()
+	updatePresence(vid, connID, realtime.DefaultPresence.Join)
+	defer updatePresence(vid, connID, realtime.DefaultPresence.Leave)
+
+	readSocket(conn, func() {
+		if err := refresh(); err != nil {
+			log.Printf("CommentsSocket: refresh limit on %s: %v", vid, err)
+		}
+		if err := realtime.DefaultPresence.Refresh(context.Background(), videoTopic(vid), connID); err != nil {
+			log.Printf("CommentsSocket: refresh presence on %s: %v", vid, err)
+		}
+	})
+}
+
+// updatePresence joins or leaves the video's presence with change and tells
+// its watchers how many of them there are now.
+func updatePresence(videoID, connID string, change func(context.Context, string, string) (int64, error)) {
+	watching, err := change(context.Background(), videoTopic(videoID), connID)
+	if err != nil {
+		log.Printf("updatePresence: %s: %v", videoID, err)
+		return
+	}
+	publishVideoEvent(videoID, EventPresence, presenceEvent{VideoID: videoID, Watching: watching})
+}
+
+// readSocket reads until the connection fails or the client stops answering
+// pings, calling onPong for each pong. Clients send everything else through
+// the REST API, so any other message is discarded.
+func readSocket(conn *websocket.Conn, onPong func()) {
+	conn.SetReadLimit(socketMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		onPong()
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("readSocket: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// writeSocket is the only goroutine writing to conn. It forwards the
+// subscription's messages and pings the client until the subscription is
+// closed, either by the handler once reading stops or by the hub when this
+// client falls too far behind, and then closes conn.
+func writeSocket(conn *websocket.Conn, sub *realtime.Subscription) {
+	ping := time.NewTicker(socketPingPeriod)
+	defer func() {
+		ping.Stop()
+		conn.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-sub.C:
+			conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if !ok {
+				code, reason := websocket.CloseNormalClosure, ""
+				if sub.Evicted() {
+					code, reason = websocket.CloseTryAgainLater, "too slow"
+				}
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
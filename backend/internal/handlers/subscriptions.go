@@ -0,0 +1,83 @@
+// This file contains the subscription handlers. Users follow channels, and
+// the subscription feed lists recent uploads from every channel they follow,
+// newest first, paged the same way as GET /v1/videos.
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+func subscriberCount(channelID string) (int64, error) {
+	var n int64
+	err := db.Conn.Model(&models.Subscription{}).Where("channel_id = ?", channelID).Count(&n).Error
+	return n, err
+}
+
+// subscriptionResponse reports the caller's state and the channel's new count.
+func subscriptionResponse(c *gin.Context, channelID string, subscribed bool) {
+	n, err := subscriberCount(channelID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscribed": subscribed, "subscriberCount": n})
+}
+
+// PUT /v1/users/:username/subscribe
+// Subscribes to a channel (idempotent - safe to call multiple times). The
+// channel can be given by username or user ID.
+func Subscribe(c *gin.Context) {
+	uid := c.GetString("uid")
+	channel, ok := findUser(c)
+	if !ok {
+		return
+	}
+	if channel.ID == uid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you can't subscribe to yourself"})
+		return
+	}
+
+	// An existing subscription is fine, and so is losing a race to create it.
+	sub := models.Subscription{SubscriberID: uid, ChannelID: channel.ID}
+	if err := db.Conn.Clauses(clause.OnConflict{DoNothing: true}).Create(&sub).Error; err != nil {
+		log.Printf("Subscribe: %s to %s: %v", uid, channel.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	subscriptionResponse(c, channel.ID, true)
+}
+
+// DELETE /v1/users/:username/subscribe
+// Unsubscribes from a channel (idempotent - safe to call multiple times).
+func Unsubscribe(c *gin.Context) {
+	uid := c.GetString("uid")
+	channel, ok := findUser(c)
+	if !ok {
+		return
+	}
+	err := db.Conn.Where("subscriber_id = ? AND channel_id = ?", uid, channel.ID).Delete(&models.Subscription{}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	// Success whether the subscription existed or not
+	subscriptionResponse(c, channel.ID, false)
+}
+
+// GET /v1/feed/subscriptions?sort=&tag=&cursor=&limit=
+// Uploads from the channels the caller follows. Takes the same parameters as
+// GET /v1/videos and defaults to newest first.
+func GetSubscriptionFeed(c *gin.Context) {
+	uid := c.GetString("uid")
+	listVideos(c, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("videos.user_id IN (SELECT channel_id FROM subscriptions WHERE subscriber_id = ?)", uid)
+	})
+}
@@ -0,0 +1,160 @@
+// This file contains the thumbnail handlers. Owners can see the frames the
+// pipeline picked out, switch to a different one, or upload an image of their
+// own through a signed URL, which is checked and resized before it is used.
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/media"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+// ownLiveVideo is ownVideo for actions that make no sense on a deleted video.
+func ownLiveVideo(c *gin.Context) (*models.Video, bool) {
+	video, ok := ownVideo(c)
+	if ok && video.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return nil, false
+	}
+	return video, ok
+}
+
+// GET /v1/videos/:id/thumbnails
+// Lists every candidate, best scoring first. Owner only.
+func GetThumbnails(c *gin.Context) {
+	video, ok := ownLiveVideo(c)
+	if !ok {
+		return
+	}
+	var thumbs []models.Thumbnail
+	if err := db.Conn.Where("video_id = ?", video.ID).Order("score DESC, id ASC").Find(&thumbs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	for i := range thumbs {
+		media.FillThumbnailSources(&thumbs[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"thumbnails": thumbs})
+}
+
+// PUT /v1/videos/:id/thumbnail  {thumbnailId}
+func SelectThumbnail(c *gin.Context) {
+	var req struct {
+		ThumbnailID uint `json:"thumbnailId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "thumbnailId is required"})
+		return
+	}
+	video, ok := ownLiveVideo(c)
+	if !ok {
+		return
+	}
+	var thumb models.Thumbnail
+	err := db.Conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&thumb, "id = ? AND video_id = ?", req.ThumbnailID, video.ID).Error; err != nil {
+			return err
+		}
+		return media.SelectThumbnail(tx, &thumb)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "thumbnail not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("SelectThumbnail: video %s: %v", video.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	thumb.Selected = true
+	media.FillThumbnailSources(&thumb)
+	c.JSON(http.StatusOK, thumb)
+}
+
+// POST /v1/videos/:id/thumbnails/initiate-upload  {fileType}
+// Returns a signed URL to PUT a custom thumbnail to, then call
+// POST /v1/videos/:id/thumbnails with the objectName.
+func InitiateThumbnailUpload(c *gin.Context) {
+	var req struct {
+		FileType string `json:"fileType" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fileType is required"})
+		return
+	}
+	ext, err := media.ImageExt(req.FileType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": media.CodeInvalidImage})
+		return
+	}
+	video, ok := ownLiveVideo(c)
+	if !ok {
+		return
+	}
+
+	objectName := media.ThumbnailUploadName(video.ObjectName, ext)
+	url, err := storage.Store.SignedPutURL(c, objectName, req.FileType, 15*time.Minute)
+	if err != nil {
+		log.Printf("InitiateThumbnailUpload: signing %s: %v", objectName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate upload"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"uploadUrl":  url,
+		"objectName": objectName,
+		"maxBytes":   media.MaxThumbnailBytes,
+	})
+}
+
+// POST /v1/videos/:id/thumbnails  {objectName}
+// Checks the uploaded image, stores it in every size and selects it.
+func CreateThumbnail(c *gin.Context) {
+	var req struct {
+		ObjectName string `json:"objectName" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "objectName is required"})
+		return
+	}
+	video, ok := ownLiveVideo(c)
+	if !ok {
+		return
+	}
+
+	thumb, err := media.ProcessThumbnailUpload(c, video.ObjectName, req.ObjectName)
+	var verr *media.VerifyError
+	if errors.As(err, &verr) {
+		c.JSON(verifyStatus(verr), gin.H{"error": verr.Message, "code": verr.Code})
+		return
+	}
+	if err != nil {
+		log.Printf("CreateThumbnail: video %s: %v", video.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not process image"})
+		return
+	}
+
+	thumb.VideoID = video.ID
+	err = db.Conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(thumb).Error; err != nil {
+			return err
+		}
+		return media.SelectThumbnail(tx, thumb)
+	})
+	if err != nil {
+		log.Printf("CreateThumbnail: video %s: %v", video.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	thumb.Selected = true
+	media.FillThumbnailSources(thumb)
+	c.JSON(http.StatusCreated, thumb)
+}
@@ -0,0 +1,307 @@
+// This file contains the handlers for resumable uploads. A client starts a
+// session, sends the file either to GCS or to our tus endpoint, and can ask
+// how many bytes arrived so far to pick up where it left off after a dropped
+// connection. Once the upload completes it calls finalize-upload as usual.
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+	"github.com/hi-wesley/mini-youtube/internal/uploads"
+)
+
+const tusVersion = "1.0.0"
+
+// uploadJSON is what the client sees of a session.
+func uploadJSON(s *models.UploadSession) gin.H {
+	h := gin.H{
+		"uploadId":   s.ID,
+		"objectName": s.ObjectName,
+		"protocol":   s.Protocol,
+		"status":     s.Status,
+		"offset":     s.Offset,
+		"size":       s.Size,
+		"expiresAt":  s.ExpiresAt,
+	}
+	if s.Status == models.UploadActive {
+		if s.Protocol == models.UploadProtocolGCS {
+			h["uploadUrl"] = s.SessionURL
+		} else {
+			h["uploadUrl"] = tusURL(s.ID)
+		}
+	}
+	return h
+}
+
+func tusURL(id string) string {
+	return strings.TrimSuffix(cfg.LocalStorageURL, "/") + "/v1/tus/" + id
+}
+
+// uploadError maps errors from the uploads package to a response.
+func uploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, uploads.ErrNotActive):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, uploads.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "code": "file_too_large"})
+	case errors.Is(err, uploads.ErrInvalidSize), errors.Is(err, uploads.ErrWrongProto):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, uploads.ErrLocked):
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+	default:
+		log.Printf("uploads: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "upload session error"})
+	}
+}
+
+// POST /v1/uploads
+// Starts a resumable upload. The response says which protocol to use.
+func StartUpload(c *gin.Context) {
+	uid := c.GetString("uid")
+	var req struct {
+		FileName string `json:"fileName" binding:"required"`
+		FileType string `json:"fileType" binding:"required"`
+		FileSize int64  `json:"fileSize" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fileName, fileType and fileSize are required"})
+		return
+	}
+
+	s, err := uploads.Start(c, uid, req.FileName, req.FileType, req.FileSize, c.GetHeader("Origin"))
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, uploadJSON(s))
+}
+
+// GET /v1/uploads/:id
+// Reports how much of the upload has been received.
+func GetUpload(c *gin.Context) {
+	s, err := uploads.Get(c, c.GetString("uid"), c.Param("id"))
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	if err := uploads.Refresh(c, s); err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, uploadJSON(s))
+}
+
+// DELETE /v1/uploads/:id
+func CancelUpload(c *gin.Context) {
+	s, err := uploads.Get(c, c.GetString("uid"), c.Param("id"))
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	if err := uploads.Cancel(c, s); err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// The handlers below speak the tus 1.0 core protocol plus the creation,
+// termination and expiration extensions, so off-the-shelf clients such as
+// tus-js-client work against local storage. See https://tus.io/protocols/resumable-upload.
+
+// tusHeaders checks Tus-Resumable and sets the headers every response carries.
+func tusHeaders(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.Status(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// tusSession loads the session in the URL, answering with the tus status
+// codes when it can't be used.
+func tusSession(c *gin.Context) *models.UploadSession {
+	s, err := uploads.Get(c, c.GetString("uid"), c.Param("id"))
+	if errors.Is(err, uploads.ErrNotFound) {
+		c.Status(http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		log.Printf("tus: loading session %s: %v", c.Param("id"), err)
+		c.Status(http.StatusInternalServerError)
+		return nil
+	}
+	if s.Protocol != models.UploadProtocolTus {
+		c.Status(http.StatusNotFound)
+		return nil
+	}
+	if s.Status == models.UploadExpired || s.Status == models.UploadCancelled {
+		c.Status(http.StatusGone)
+		return nil
+	}
+	return s
+}
+
+// OPTIONS /v1/tus
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", "creation,termination,expiration")
+	c.Header("Tus-Max-Size", strconv.FormatInt(cfg.MaxUploadBytes, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// POST /v1/tus
+// Creates a session from Upload-Length and Upload-Metadata (filename, filetype).
+func TusCreate(c *gin.Context) {
+	if !tusHeaders(c) {
+		return
+	}
+	size, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Upload-Length is required")
+		return
+	}
+	meta := tusMetadata(c.GetHeader("Upload-Metadata"))
+	if meta["filename"] == "" {
+		c.String(http.StatusBadRequest, "filename metadata is required")
+		return
+	}
+	fileType := meta["filetype"]
+	if fileType == "" {
+		fileType = "application/octet-stream"
+	}
+
+	s, err := uploads.Start(c, c.GetString("uid"), meta["filename"], fileType, size, "")
+	switch {
+	case errors.Is(err, uploads.ErrTooLarge):
+		c.String(http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case errors.Is(err, uploads.ErrInvalidSize):
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		log.Printf("tus: create: %v", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Location", tusURL(s.ID))
+	c.Header("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	// Not part of tus; lets our client finalize without a second lookup.
+	c.Header("X-Object-Name", s.ObjectName)
+	c.Status(http.StatusCreated)
+}
+
+// tusMetadata decodes "key base64value,key2 base64value2".
+func tusMetadata(header string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		out[key] = string(decoded)
+	}
+	return out
+}
+
+// HEAD /v1/tus/:id
+func TusHead(c *gin.Context) {
+	if !tusHeaders(c) {
+		return
+	}
+	s := tusSession(c)
+	if s == nil {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(s.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(s.Size, 10))
+	c.Header("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusOK)
+}
+
+// PATCH /v1/tus/:id
+func TusPatch(c *gin.Context) {
+	if !tusHeaders(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.Status(http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.String(http.StatusBadRequest, "Upload-Offset is required")
+		return
+	}
+	s := tusSession(c)
+	if s == nil {
+		return
+	}
+	if s.Status == models.UploadCompleted || s.Status == models.UploadFinalized {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	if offset != s.Offset {
+		c.Status(http.StatusConflict)
+		return
+	}
+
+	n, err := uploads.WriteChunk(c, s, offset, c.Request.Body)
+	c.Header("Upload-Offset", strconv.FormatInt(n, 10))
+	c.Header("Upload-Expires", time.Now().Add(cfg.UploadSessionTTL).UTC().Format(http.TimeFormat))
+	switch {
+	case errors.Is(err, storage.ErrOffsetMismatch):
+		c.Status(http.StatusConflict)
+	case errors.Is(err, uploads.ErrLocked):
+		c.Status(http.StatusLocked)
+	case errors.Is(err, uploads.ErrNotActive):
+		c.Status(http.StatusGone)
+	case err != nil && !errors.Is(err, io.ErrUnexpectedEOF):
+		log.Printf("tus: patch %s: %v", s.ID, err)
+		c.Status(http.StatusInternalServerError)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// DELETE /v1/tus/:id
+func TusDelete(c *gin.Context) {
+	if !tusHeaders(c) {
+		return
+	}
+	s := tusSession(c)
+	if s == nil {
+		return
+	}
+	err := uploads.Cancel(c, s)
+	if errors.Is(err, uploads.ErrNotActive) {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("tus: delete %s: %v", s.ID, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,273 @@
+// This file contains the channel page handlers: anyone can look up a user by
+// username, see their public profile with a few totals, and list the videos
+// they uploaded. Users edit their own bio, links and banner through
+// PATCH /v1/profile.
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/media"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+const (
+	maxBioLength   = 1000
+	maxLinks       = 5
+	maxLinkTitle   = 50
+	maxLinkURLSize = 500
+)
+
+// findUser loads the user in the URL, matching the username case-insensitively
+// the same way CheckUsername does. A user ID works too and wins, so nobody can
+// take over another user's ID by registering it as their username.
+func findUser(c *gin.Context) (*models.User, bool) {
+	var u models.User
+	name := c.Param("username")
+	err := db.Conn.Where("id = ?", name).Take(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = db.Conn.Where("LOWER(username) = LOWER(?)", name).Take(&u).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return nil, false
+	}
+	return &u, true
+}
+
+// publicUser is what other people see of a user; the email stays private.
+func publicUser(u *models.User) gin.H {
+	links := u.Links
+	if links == nil {
+		links = []models.ProfileLink{}
+	}
+	return gin.H{
+		"ID":        u.ID,
+		"Username":  u.Username,
+		"AvatarURL": u.AvatarURL,
+		"Bio":       u.Bio,
+		"BannerURL": u.BannerURL,
+		"Links":     links,
+		"CreatedAt": u.CreatedAt,
+	}
+}
+
+// GET /v1/users/:username
+func GetUser(c *gin.Context) {
+	u, ok := findUser(c)
+	if !ok {
+		return
+	}
+
+	// Totals only count what everyone can see.
+	var stats struct {
+		VideoCount int64
+		TotalViews int64
+	}
+	err := db.Conn.Table("videos").
+		Select("count(*) AS video_count, coalesce(sum(views), 0) AS total_views").
+		Scopes(listedTo("")).
+		Where("videos.user_id = ?", u.ID).
+		Scan(&stats).Error
+	if err != nil {
+		log.Printf("GetUser: stats for %s: %v", u.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	subscribers, err := subscriberCount(u.ID)
+	if err != nil {
+		log.Printf("GetUser: subscribers of %s: %v", u.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	// Whether the caller follows this channel, for the subscribe button.
+	subscribed := false
+	if uid := c.GetString("uid"); uid != "" {
+		var n int64
+		db.Conn.Model(&models.Subscription{}).Where("subscriber_id = ? AND channel_id = ?", uid, u.ID).Count(&n)
+		subscribed = n > 0
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": publicUser(u),
+		"stats": gin.H{
+			"videoCount":      stats.VideoCount,
+			"totalViews":      stats.TotalViews,
+			"subscriberCount": subscribers,
+		},
+		"subscribed": subscribed,
+	})
+}
+
+// GET /v1/users/:username/videos?sort=&tag=&cursor=&limit=
+// Takes the same parameters as GET /v1/videos.
+func GetUserVideos(c *gin.Context) {
+	u, ok := findUser(c)
+	if !ok {
+		return
+	}
+	listVideos(c, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("videos.user_id = ?", u.ID)
+	})
+}
+
+// PATCH /v1/profile  {bio?, links?, bannerObjectName?}
+// bannerObjectName is an image uploaded through
+// POST /v1/profile/banner/initiate-upload; "" removes the banner.
+func UpdateProfile(c *gin.Context) {
+	uid := c.GetString("uid")
+	var req struct {
+		Bio              *string               `json:"bio"`
+		Links            *[]models.ProfileLink `json:"links"`
+		BannerObjectName *string               `json:"bannerObjectName"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var u models.User
+	if err := db.Conn.First(&u, "id = ?", uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	// Selecting the columns lets Updates write empty values and still run the
+	// json serializer on Links.
+	var columns []string
+	oldBanner := u.BannerURL
+	if req.Bio != nil {
+		bio := strings.TrimSpace(*req.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bio is too long"})
+			return
+		}
+		u.Bio = bio
+		columns = append(columns, "bio")
+	}
+	if req.Links != nil {
+		links, err := cleanLinks(*req.Links)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		u.Links = links
+		columns = append(columns, "links")
+	}
+	if req.BannerObjectName != nil {
+		name := *req.BannerObjectName
+		switch {
+		case name == "":
+			u.BannerURL = ""
+		case !strings.HasPrefix(name, media.BannerPrefix(uid)) || strings.Contains(name, ".."):
+			c.JSON(http.StatusForbidden, gin.H{"error": "object does not belong to this user", "code": media.CodeInvalidObject})
+			return
+		default:
+			localPath, err := media.VerifyImage(c, name, media.BannerLimits)
+			var verr *media.VerifyError
+			if errors.As(err, &verr) {
+				storage.Store.Delete(c, name)
+				c.JSON(verifyStatus(verr), gin.H{"error": verr.Message, "code": verr.Code})
+				return
+			}
+			if err != nil {
+				log.Printf("UpdateProfile: verifying banner %s: %v", name, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not verify banner"})
+				return
+			}
+			os.Remove(localPath)
+			u.BannerURL = storage.Store.PublicURL(name)
+		}
+		columns = append(columns, "banner_url")
+	}
+	if len(columns) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
+	if err := db.Conn.Model(&u).Select(columns).Updates(&u).Error; err != nil {
+		log.Printf("UpdateProfile: %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if oldBanner != "" && oldBanner != u.BannerURL {
+		if name, ok := storage.ObjectName(storage.Store, oldBanner); ok {
+			if err := storage.Store.Delete(c, name); err != nil && !errors.Is(err, storage.ErrNotExist) {
+				log.Printf("UpdateProfile: deleting old banner %s: %v", name, err)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// cleanLinks trims the links and checks there aren't too many and that each
+// is an absolute http(s) URL.
+func cleanLinks(in []models.ProfileLink) ([]models.ProfileLink, error) {
+	if len(in) > maxLinks {
+		return nil, errors.New("at most 5 links are allowed")
+	}
+	out := make([]models.ProfileLink, 0, len(in))
+	for _, l := range in {
+		l.Title = strings.TrimSpace(l.Title)
+		l.URL = strings.TrimSpace(l.URL)
+		u, err := url.Parse(l.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(l.URL) > maxLinkURLSize {
+			return nil, errors.New("links must be http or https URLs")
+		}
+		if l.Title == "" {
+			l.Title = u.Host
+		}
+		if utf8.RuneCountInString(l.Title) > maxLinkTitle {
+			return nil, errors.New("link titles must be at most 50 characters")
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// POST /v1/profile/banner/initiate-upload  {fileType}
+// Returns a signed URL to PUT a banner to, then pass the objectName to
+// PATCH /v1/profile as bannerObjectName.
+func InitiateBannerUpload(c *gin.Context) {
+	var req struct {
+		FileType string `json:"fileType" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fileType is required"})
+		return
+	}
+	ext, err := media.ImageExt(req.FileType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": media.CodeInvalidImage})
+		return
+	}
+
+	objectName := media.NewBannerName(c.GetString("uid"), ext)
+	url, err := storage.Store.SignedPutURL(c, objectName, req.FileType, 15*time.Minute)
+	if err != nil {
+		log.Printf("InitiateBannerUpload: signing %s: %v", objectName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate upload"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"uploadUrl":  url,
+		"objectName": objectName,
+		"maxBytes":   media.BannerLimits.MaxBytes,
+	})
+}
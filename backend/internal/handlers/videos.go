@@ -5,42 +5,34 @@
 package handlers
 
 import (
-	"bytes"
-	"context"
-	"fmt"
-	"io"
+	"errors"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	"cloud.google.com/go/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/hi-wesley/mini-youtube/internal/ai"
 	"github.com/hi-wesley/mini-youtube/internal/config"
 	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/media"
 	"github.com/hi-wesley/mini-youtube/internal/models"
-	"github.com/modfy/fluent-ffmpeg"
+	"github.com/hi-wesley/mini-youtube/internal/pipeline"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+	"github.com/hi-wesley/mini-youtube/internal/uploads"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-var (
-	storageClient *storage.Client
-	cfg           *config.Config
-)
+var cfg *config.Config
 
 func init() {
-	var err error
-	storageClient, err = storage.NewClient(context.Background())
-	if err != nil {
-		log.Fatalf("Failed to create storage client: %v", err)
-	}
 	cfg = config.Load()
 }
 
-// InitiateUpload generates a signed URL for direct GCS upload.
+// InitiateUpload generates a signed URL for direct upload to the blob store.
 func InitiateUpload(c *gin.Context) {
 	uid := c.GetString("uid")
 	var req struct {
@@ -52,21 +44,11 @@ func InitiateUpload(c *gin.Context) {
 		return
 	}
 
-	objectName := fmt.Sprintf("videos/%s/%d-%s", uid, time.Now().Unix(), req.FileName)
-	log.Printf("InitiateUpload: using bucket '%s', object '%s'", cfg.GcsBucket, objectName)
-	
-	if cfg.GcsBucket == "" {
-		log.Printf("InitiateUpload: ERROR - GCS bucket name is empty!")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "GCS bucket not configured"})
-		return
-	}
+	objectName := media.NewUploadName(uid, req.FileName)
+	log.Printf("InitiateUpload: using %s storage, object '%s'", cfg.StorageBackend, objectName)
 
 	// Create a signed URL for PUT request
-	url, err := storageClient.Bucket(cfg.GcsBucket).SignedURL(objectName, &storage.SignedURLOptions{
-		Method:      "PUT",
-		Expires:     time.Now().Add(15 * time.Minute),
-		ContentType: req.FileType,
-	})
+	url, err := storage.Store.SignedPutURL(c, objectName, req.FileType, 15*time.Minute)
 	if err != nil {
 		log.Printf("Failed to generate signed URL: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate upload"})
@@ -79,148 +61,370 @@ func InitiateUpload(c *gin.Context) {
 	})
 }
 
-// FinalizeUpload creates the video record after the file is in GCS.
+var errAlreadyFinalized = errors.New("upload already finalized")
+
+// FinalizeUpload creates the video record after the file is in the blob store.
 func FinalizeUpload(c *gin.Context) {
 	uid := c.GetString("uid")
 	var req struct {
-		ObjectName  string `json:"objectName" binding:"required"`
-		Title       string `json:"title" binding:"required"`
-		Description string `json:"description" binding:"required"`
+		ObjectName  string     `json:"objectName" binding:"required"`
+		Title       string     `json:"title" binding:"required"`
+		Description string     `json:"description" binding:"required"`
+		Visibility  string     `json:"visibility"` // defaults to public
+		PublishAt   *time.Time `json:"publishAt"`  // required when scheduled
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "objectName, title, and description are required"})
 		return
 	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" || utf8.RuneCountInString(req.Title) > 120 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title must be 1 to 120 characters"})
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = models.VisibilityPublic
+	}
+	if msg := checkVisibility(req.Visibility, req.PublishAt); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
-	// Generate thumbnail from the uploaded video
-	thumbnailURL, err := generateThumbnail(req.ObjectName, uid)
+	// Don't trust the client: the object must be the caller's own upload and
+	// an actual video within our limits.
+	probe, err := media.VerifyUpload(c, uid, req.ObjectName, media.Limits{
+		MaxBytes:    cfg.MaxUploadBytes,
+		MaxDuration: cfg.MaxVideoDuration,
+	})
+	var verr *media.VerifyError
+	if errors.As(err, &verr) {
+		log.Printf("FinalizeUpload: rejected %s: %v", req.ObjectName, verr)
+		if verr.Content {
+			discardUpload(c, req.ObjectName)
+		}
+		c.JSON(verifyStatus(verr), gin.H{"error": verr.Message, "code": verr.Code})
+		return
+	}
 	if err != nil {
-		log.Printf("FinalizeUpload: thumbnail generation failed: %v", err)
-		// Continue without thumbnail rather than failing the entire upload
-		thumbnailURL = ""
+		log.Printf("FinalizeUpload: verifying %s failed: %v", req.ObjectName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not verify upload"})
+		return
 	}
 
 	vid := models.Video{
-		ID:           uuid.NewString(),
-		UserID:       uid,
-		Title:        req.Title,
-		Description:  req.Description,
-		ObjectName:   req.ObjectName,
-		ThumbnailURL: thumbnailURL,
-	}
-	if err := db.Conn.Create(&vid).Error; err != nil {
-		log.Printf("FinalizeUpload: db.Conn.Create error: %v", err)
+		ID:          uuid.NewString(),
+		UserID:      uid,
+		Title:       req.Title,
+		Description: req.Description,
+		ObjectName:  req.ObjectName,
+		Status:      models.VideoUploaded,
+		Visibility:  req.Visibility,
+		PublishAt:   req.PublishAt,
+		HLSStatus:   models.HLSPending,
+		Duration:    probe.Duration,
+		Width:       probe.Width,
+		Height:      probe.Height,
+	}
+	// Probing, thumbnail, HLS transcode and AI summary run as background jobs;
+	// they are committed together with the video so none of them can be lost.
+	// The video stays hidden from other users until they finish.
+	// The unique index on object_name settles concurrent finalizes of the
+	// same upload: only one of them inserts a row.
+	err = db.Conn.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "object_name"}}, DoNothing: true}).Create(&vid)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errAlreadyFinalized
+		}
+		if err := uploads.MarkFinalized(tx, vid.ObjectName); err != nil {
+			return err
+		}
+		return pipeline.EnqueueVideo(tx, vid.ID)
+	})
+	if errors.Is(err, errAlreadyFinalized) {
+		c.JSON(http.StatusConflict, gin.H{"error": "upload already finalized", "code": "already_finalized"})
+		return
+	}
+	if err != nil {
+		log.Printf("FinalizeUpload: create video error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
 
-	go ai.GenerateAndCacheSummary(vid.ID, "gs://"+cfg.GcsBucket+"/"+req.ObjectName)
-
 	c.JSON(http.StatusCreated, vid)
 }
 
-// generateThumbnail downloads video from GCS, generates thumbnail, uploads it back
-func generateThumbnail(objectName, uid string) (string, error) {
-	ctx := context.Background()
-	
-	// Create temporary files
-	tempVideo, err := os.CreateTemp("", "video-*.mp4")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp video file: %v", err)
+// verifyStatus is the response status for a rejected upload.
+func verifyStatus(verr *media.VerifyError) int {
+	switch verr.Code {
+	case media.CodeInvalidObject:
+		return http.StatusForbidden
+	case media.CodeObjectNotFound:
+		return http.StatusNotFound
+	case media.CodeFileTooLarge:
+		return http.StatusRequestEntityTooLarge
 	}
-	defer os.Remove(tempVideo.Name())
-	defer tempVideo.Close()
+	return http.StatusUnprocessableEntity
+}
 
-	// Download video from GCS
-	reader, err := storageClient.Bucket(cfg.GcsBucket).Object(objectName).NewReader(ctx)
+// discardUpload quarantines or deletes an upload that failed verification.
+func discardUpload(c *gin.Context, objectName string) {
+	var err error
+	if cfg.QuarantineRejected {
+		err = storage.Move(c, storage.Store, objectName, media.QuarantineName(objectName))
+	} else {
+		err = storage.Store.Delete(c, objectName)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCS reader: %v", err)
+		log.Printf("FinalizeUpload: discarding %s failed: %v", objectName, err)
 	}
-	defer reader.Close()
+}
 
-	if _, err := io.Copy(tempVideo, reader); err != nil {
-		return "", fmt.Errorf("failed to download video: %v", err)
+// visibleTo limits a video query to what uid may open: ready public and
+// unlisted videos, scheduled ones whose publish time has passed, and the
+// caller's own uploads in any state. Deleted videos are hidden from everyone,
+// including their owner.
+func visibleTo(uid string) func(*gorm.DB) *gorm.DB {
+	return shownTo(uid, models.VisibilityPublic, models.VisibilityUnlisted)
+}
+
+// listedTo is visibleTo for listings, search and totals, which leave
+// unlisted videos out.
+func listedTo(uid string) func(*gorm.DB) *gorm.DB {
+	return shownTo(uid, models.VisibilityPublic)
+}
+
+func shownTo(uid string, visibilities ...string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("videos.deleted_at IS NULL")
+		// The scheduler flips scheduled videos to public every minute; checking
+		// publish_at here as well means they appear right on time.
+		shown := `videos.status = ? AND (videos.visibility IN ?
+			OR (videos.visibility = ? AND videos.publish_at <= now()))`
+		args := []interface{}{models.VideoReady, visibilities, models.VisibilityScheduled}
+		if uid == "" {
+			return tx.Where(shown, args...)
+		}
+		return tx.Where("(("+shown+") OR videos.user_id = ?)", append(args, uid)...)
 	}
-	tempVideo.Close()
+}
 
-	// Get video duration for thumbnail timing
-	metadata, err := fluentffmpeg.Probe(tempVideo.Name())
-	if err != nil {
-		return "", fmt.Errorf("failed to probe video: %v", err)
+// maxScheduleAhead is how far ahead a video can be scheduled.
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// checkVisibility validates a requested visibility and publish time and
+// returns what is wrong with them, or "".
+func checkVisibility(visibility string, publishAt *time.Time) string {
+	switch visibility {
+	case models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate:
+		if publishAt != nil {
+			return "publishAt is only allowed for scheduled videos"
+		}
+	case models.VisibilityScheduled:
+		switch {
+		case publishAt == nil:
+			return "scheduled videos need a publishAt time"
+		case !publishAt.After(time.Now()):
+			return "publishAt must be in the future"
+		case publishAt.After(time.Now().Add(maxScheduleAhead)):
+			return "publishAt must be within a year"
+		}
+	default:
+		return "visibility must be public, unlisted, private or scheduled"
+	}
+	return ""
+}
+
+// videoSorts maps the sort query parameter to the value videos are ordered
+// by. Every mode breaks ties on id so the order is total.
+var videoSorts = map[string]struct {
+	expr string // over the columns selected in GetVideos; "" sorts by created_at
+	desc bool
+}{
+	"newest": {"", true},
+	"oldest": {"", false},
+	"views":  {"views", true},
+	"likes":  {"like_count", true},
+	// Engagement decays with age; the reference time is pinned in the cursor
+	// so scores don't shift between pages.
+	"trending": {"(views + 3 * like_count + 1) / power(greatest(extract(epoch FROM (to_timestamp(?) - created_at)) / 3600, 0) + 2, 1.5)", true},
+}
+
+// videoCursor is the keyset of the last video on a page.
+type videoCursor struct {
+	Sort string    `json:"s"`
+	ID   string    `json:"id"`
+	At   time.Time `json:"at"`
+	N    float64   `json:"n"`
+	Now  int64     `json:"now,omitempty"`
+}
+
+// GET /v1/videos?sort=&uploader=&tag=&cursor=&limit=
+// sort is one of newest (default), oldest, views, likes or trending.
+func GetVideos(c *gin.Context) {
+	var filters []func(*gorm.DB) *gorm.DB
+	if uploader := c.Query("uploader"); uploader != "" {
+		filters = append(filters, func(tx *gorm.DB) *gorm.DB {
+			return tx.Joins("JOIN users ON users.id = videos.user_id").
+				Where("LOWER(users.username) = LOWER(?) OR users.id = ?", uploader, uploader)
+		})
 	}
+	listVideos(c, filters...)
+}
 
-	formatData, ok := metadata["format"].(map[string]interface{})
+// listVideos answers a video listing: the videos visible to the caller that
+// pass filters, sorted and paginated as the query string asks, optionally
+// narrowed to a tag.
+func listVideos(c *gin.Context, filters ...func(*gorm.DB) *gorm.DB) {
+	uid := c.GetString("uid")
+	sortName := c.DefaultQuery("sort", "newest")
+	sort, ok := videoSorts[sortName]
 	if !ok {
-		return "", fmt.Errorf("format data not found in metadata")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be newest, oldest, views, likes or trending"})
+		return
+	}
+	limit := 20
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, 50)
 	}
 
-	durationStr, ok := formatData["duration"].(string)
-	if !ok {
-		return "", fmt.Errorf("duration not found in format data")
+	var cur *videoCursor
+	if s := c.Query("cursor"); s != "" {
+		cur = &videoCursor{}
+		if err := db.DecodeCursor(s, cur); err != nil || cur.Sort != sortName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+	}
+	now := time.Now().Unix()
+	if cur != nil && cur.Now != 0 {
+		now = cur.Now
 	}
 
-	duration, err := strconv.ParseFloat(durationStr, 64)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse duration: %v", err)
-	}
-
-	// Generate thumbnail at 1/4 of video duration
-	seekTime := duration / 4
-	hours := int(seekTime / 3600)
-	minutes := int((seekTime - float64(hours*3600)) / 60)
-	seconds := int(seekTime - float64(hours*3600) - float64(minutes*60))
-	seekTimeString := fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
-
-	// Generate thumbnail
-	buf := bytes.NewBuffer(nil)
-	err = fluentffmpeg.NewCommand("").
-		InputPath(tempVideo.Name()).
-		OutputFormat("image2").
-		OutputOptions("-vframes", "1", "-ss", seekTimeString).
-		PipeOutput(buf).Run()
-	if err != nil {
-		return "", fmt.Errorf("ffmpeg thumbnail generation failed: %v", err)
+	inner := db.Conn.Table("videos").
+		Select(`videos.id, videos.created_at, videos.views,
+			(SELECT count(*) FROM likes WHERE likes.video_id = videos.id) AS like_count`).
+		Scopes(listedTo(uid)).
+		Scopes(filters...)
+	if tag := c.Query("tag"); tag != "" {
+		inner = inner.Where("EXISTS (SELECT 1 FROM video_tags WHERE video_tags.video_id = videos.id AND video_tags.tag = ?)",
+			strings.ToLower(strings.TrimSpace(tag)))
 	}
 
-	// Upload thumbnail to GCS
-	thumbnailObject := fmt.Sprintf("thumbnails/%s/%d-thumbnail.jpg", uid, time.Now().Unix())
-	thumbnailWriter := storageClient.Bucket(cfg.GcsBucket).Object(thumbnailObject).NewWriter(ctx)
-	thumbnailWriter.ContentType = "image/jpeg"
+	// Wrap the inner query so the sort value can be filtered and ordered by
+	// its alias.
+	sortExpr := "0"
+	var sortArgs []interface{}
+	if sort.expr != "" {
+		sortExpr = sort.expr
+		if sortName == "trending" {
+			sortArgs = append(sortArgs, now)
+		}
+	}
+	ranked := db.Conn.Table("(?) AS v", inner).Select("v.*, ("+sortExpr+")::float8 AS sort_value", sortArgs...)
 
-	if _, err := io.Copy(thumbnailWriter, buf); err != nil {
-		return "", fmt.Errorf("failed to upload thumbnail: %v", err)
+	dir, cmp := "ASC", ">"
+	if sort.desc {
+		dir, cmp = "DESC", "<"
+	}
+	key := "sort_value"
+	if sort.expr == "" {
+		key = "created_at"
+	}
+	page := db.Conn.Table("(?) AS ranked", ranked).Order(key + " " + dir + ", id " + dir)
+	if cur != nil {
+		var last interface{} = cur.N
+		if sort.expr == "" {
+			last = cur.At
+		}
+		page = page.Where("("+key+", id) "+cmp+" (?, ?)", last, cur.ID)
 	}
 
-	if err := thumbnailWriter.Close(); err != nil {
-		return "", fmt.Errorf("failed to close thumbnail writer: %v", err)
+	var rows []struct {
+		ID        string
+		CreatedAt time.Time
+		LikeCount int64
+		SortValue float64
+	}
+	// one extra row tells us whether there is another page
+	if err := page.Limit(limit + 1).Scan(&rows).Error; err != nil {
+		log.Printf("listVideos: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	nextCursor := ""
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		next := videoCursor{Sort: sortName, ID: last.ID, At: last.CreatedAt, N: last.SortValue}
+		if sortName == "trending" {
+			next.Now = now
+		}
+		nextCursor = db.EncodeCursor(next)
 	}
 
-	thumbnailURL := fmt.Sprintf("https://storage.googleapis.com/%s/%s", cfg.GcsBucket, thumbnailObject)
-	return thumbnailURL, nil
-}
+	ids := make([]string, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+	}
+	var found []models.Video
+	if len(ids) > 0 {
+		if err := db.Conn.Preload("User").Where("id IN ?", ids).Find(&found).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+	liked := map[string]bool{}
+	if uid != "" && len(ids) > 0 {
+		var likedIDs []string
+		db.Conn.Model(&models.Like{}).Where("user_id = ? AND video_id IN ?", uid, ids).Pluck("video_id", &likedIDs)
+		for _, id := range likedIDs {
+			liked[id] = true
+		}
+	}
 
+	byID := make(map[string]models.Video, len(found))
+	for _, v := range found {
+		byID[v.ID] = v
+	}
+	videos := make([]models.Video, 0, len(rows))
+	for _, r := range rows {
+		v, ok := byID[r.ID]
+		if !ok {
+			continue // deleted between the two queries
+		}
+		v.Likes = int(r.LikeCount)
+		v.IsLiked = liked[v.ID]
+		videos = append(videos, v)
+	}
 
-func GetVideos(c *gin.Context) {
-    var videos []models.Video
-    err := db.Conn.
-        Preload("User").
-        Order("created_at ASC").
-        Find(&videos).Error
-
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
-        return
-    }
-
-    c.JSON(http.StatusOK, videos)
+	c.JSON(http.StatusOK, gin.H{
+		"videos":     videos,
+		"nextCursor": nextCursor,
+	})
 }
 
 func GetVideo(c *gin.Context) {
 	var video models.Video
-	if err := db.Conn.Preload("User").First(&video, "id = ?", c.Param("id")).Error; err != nil {
+	if err := db.Conn.Scopes(visibleTo(c.GetString("uid"))).Preload("User").Preload("Renditions").Preload("Tags").Preload("Analysis").First(&video, "id = ?", c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
 		return
 	}
+	if video.HLSStatus == models.HLSReady && video.HLSPlaylist != "" {
+		video.PlaylistURL = storage.Store.PublicURL(video.HLSPlaylist)
+	}
+	var thumb models.Thumbnail
+	if err := db.Conn.Where("video_id = ? AND selected", video.ID).Take(&thumb).Error; err == nil {
+		media.FillThumbnailSources(&thumb)
+		video.Thumbnail = &thumb
+	}
 
 	// Get like count
 	var likeCount int64
@@ -239,32 +443,217 @@ func GetVideo(c *gin.Context) {
 	c.JSON(http.StatusOK, video)
 }
 
-func IncrementView(c *gin.Context) {
+// GET /v1/videos/:id/status
+// Reports where a video is in the processing pipeline, including why any
+// step failed. Videos that aren't ready are only visible to their owner.
+func GetVideoStatus(c *gin.Context) {
+	var video models.Video
+	err := db.Conn.Scopes(visibleTo(c.GetString("uid"))).
+		Preload("Steps", func(tx *gorm.DB) *gorm.DB { return tx.Order("updated_at ASC") }).
+		Preload("Renditions").
+		First(&video, "id = ?", c.Param("id")).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":            video.ID,
+		"status":        video.Status,
+		"failureReason": video.FailureReason,
+		"hlsStatus":     video.HLSStatus,
+		"steps":         video.Steps,
+		"renditions":    video.Renditions,
+	})
+}
+
+// ownVideo loads the video in the URL for its owner, deleted or not. Anyone
+// else gets a 403, or a 404 when the video doesn't exist.
+func ownVideo(c *gin.Context) (*models.Video, bool) {
 	var video models.Video
 	if err := db.Conn.First(&video, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return nil, false
+	}
+	if video.UserID != c.GetString("uid") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the uploader can change this video"})
+		return nil, false
+	}
+	return &video, true
+}
+
+// PATCH /v1/videos/:id  {title?, description?}
+func UpdateVideo(c *gin.Context) {
+	var req struct {
+		Title       *string    `json:"title"`
+		Description *string    `json:"description"`
+		Visibility  *string    `json:"visibility"`
+		PublishAt   *time.Time `json:"publishAt"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	video, ok := ownVideo(c)
+	if !ok {
+		return
+	}
+	if video.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" || utf8.RuneCountInString(title) > 120 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title must be 1 to 120 characters"})
+			return
+		}
+		updates["title"] = title
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.Visibility != nil || req.PublishAt != nil {
+		// Rescheduling on its own keeps the video scheduled; any other
+		// visibility clears the publish time.
+		visibility := video.Visibility
+		if req.Visibility != nil {
+			visibility = *req.Visibility
+		}
+		if msg := checkVisibility(visibility, req.PublishAt); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		updates["visibility"] = visibility
+		updates["publish_at"] = req.PublishAt
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+	if err := db.Conn.Model(video).Updates(updates).Error; err != nil {
+		log.Printf("UpdateVideo: %s: %v", video.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, video)
+}
+
+// DELETE /v1/videos/:id
+// Hides the video straight away. It can be restored until restoreUntil, after
+// which the purge job removes it along with its files, comments and likes.
+func DeleteVideo(c *gin.Context) {
+	video, ok := ownVideo(c)
+	if !ok {
+		return
+	}
+	if video.DeletedAt == nil {
+		now := time.Now()
+		if err := db.Conn.Model(video).Update("deleted_at", now).Error; err != nil {
+			log.Printf("DeleteVideo: %s: %v", video.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		video.DeletedAt = &now
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":           video.ID,
+		"deletedAt":    video.DeletedAt,
+		"restoreUntil": video.DeletedAt.Add(cfg.VideoRestoreWindow),
+	})
+}
+
+// POST /v1/videos/:id/restore
+func RestoreVideo(c *gin.Context) {
+	video, ok := ownVideo(c)
+	if !ok {
+		return
+	}
+	if video.DeletedAt == nil {
+		c.JSON(http.StatusOK, video)
+		return
+	}
+	if time.Since(*video.DeletedAt) > cfg.VideoRestoreWindow {
+		c.JSON(http.StatusGone, gin.H{"error": "the restore window has passed"})
+		return
+	}
+	// The purge job claims a video by moving it to purging, and only if
+	// deleted_at is still set. Restoring only videos it hasn't claimed keeps
+	// the two from racing: whichever update lands first wins.
+	res := db.Conn.Model(&models.Video{}).
+		Where("id = ? AND deleted_at IS NOT NULL AND status <> ?", video.ID, models.VideoPurging).
+		Update("deleted_at", nil)
+	if res.Error != nil {
+		log.Printf("RestoreVideo: %s: %v", video.ID, res.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		// Either a concurrent restore got there first or the purge did.
+		if err := db.Conn.First(video, "id = ?", video.ID).Error; err == nil && video.DeletedAt == nil {
+			c.JSON(http.StatusOK, video)
+			return
+		}
+		c.JSON(http.StatusGone, gin.H{"error": "the restore window has passed"})
+		return
+	}
+	video.DeletedAt = nil
+	c.JSON(http.StatusOK, video)
+}
+
+func IncrementView(c *gin.Context) {
+	var video models.Video
+	if err := db.Conn.Scopes(visibleTo(c.GetString("uid"))).First(&video, "id = ?", c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
 		return
 	}
-	db.Conn.Model(&video).Update("views", gorm.Expr("views + 1"))
+	err := db.Conn.Model(&video).Clauses(clause.Returning{Columns: []clause.Column{{Name: "views"}}}).
+		Update("views", gorm.Expr("views + 1")).Error
+	if err == nil {
+		publishVideoEvent(video.ID, EventViewCount, viewCountEvent{VideoID: video.ID, Delta: 1, Views: video.Views})
+	}
 	c.Status(http.StatusOK)
 }
 
+// publishLikes tells the video's watchers its like count changed by delta.
+func publishLikes(videoID string, delta int64) {
+	var likes int64
+	if err := db.Conn.Model(&models.Like{}).Where("video_id = ?", videoID).Count(&likes).Error; err != nil {
+		log.Printf("publishLikes: %s: %v", videoID, err)
+		return
+	}
+	publishVideoEvent(videoID, EventLikeCount, likeCountEvent{VideoID: videoID, Delta: delta, Likes: likes})
+}
+
 func ToggleLike(c *gin.Context) {
 	uid := c.GetString("uid")
 	vid := c.Param("id")
 
 	var like models.Like
 	if err := db.Conn.First(&like, "user_id = ? AND video_id = ?", uid, vid).Error; err == nil {
-		db.Conn.Delete(&like)
+		if db.Conn.Delete(&like).RowsAffected > 0 {
+			publishLikes(vid, -1)
+		}
 		c.Status(http.StatusOK)
 		return
 	}
 
+	// Taking a like back is always allowed, but a new one needs a video the
+	// user can see.
+	var video models.Video
+	if err := db.Conn.Scopes(visibleTo(uid)).First(&video, "id = ?", vid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+		return
+	}
+
 	like = models.Like{UserID: uid, VideoID: vid}
 	if err := db.Conn.Create(&like).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	publishLikes(vid, 1)
 	c.Status(http.StatusOK)
 }
 
@@ -275,7 +664,7 @@ func CreateLike(c *gin.Context) {
 
 	// Check if video exists
 	var video models.Video
-	if err := db.Conn.First(&video, "id = ?", vid).Error; err != nil {
+	if err := db.Conn.Scopes(visibleTo(uid)).First(&video, "id = ?", vid).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
 		return
 	}
@@ -299,6 +688,7 @@ func CreateLike(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	publishLikes(vid, 1)
 	c.Status(http.StatusOK)
 }
 
@@ -313,6 +703,9 @@ func RemoveLike(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	if result.RowsAffected > 0 {
+		publishLikes(vid, -1)
+	}
 
 	// Success whether like existed or not (idempotent)
 	c.Status(http.StatusOK)
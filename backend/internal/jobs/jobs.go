@@ -0,0 +1,127 @@
+// This file is the producer side of the background job queue. Work that must
+// survive a Cloud Run instance being recycled (thumbnails, transcodes, AI
+// summaries, ...) is written to the `jobs` table instead of being run in a
+// goroutine, and a worker pool (see worker.go) picks it up from there.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+// Handler processes one job. Returning an error schedules a retry.
+type Handler func(ctx context.Context, job *models.Job) error
+
+var (
+	mu       sync.RWMutex
+	handlers = map[string]Handler{}
+)
+
+// Register installs the handler for a job type.
+func Register(jobType string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[jobType] = h
+}
+
+// Handle registers a typed handler whose payload is decoded from JSON.
+func Handle[T any](jobType string, fn func(ctx context.Context, payload T) error) {
+	Register(jobType, func(ctx context.Context, job *models.Job) error {
+		var payload T
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return Permanent(fmt.Errorf("invalid payload: %w", err))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+func registeredTypes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	types := make([]string, 0, len(handlers))
+	for t := range handlers {
+		types = append(types, t)
+	}
+	return types
+}
+
+func handlerFor(jobType string) (Handler, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	h, ok := handlers[jobType]
+	return h, ok
+}
+
+// Option customises a job at enqueue time.
+type Option func(*models.Job)
+
+// MaxAttempts sets how many times the job is tried before it is marked dead.
+func MaxAttempts(n int) Option {
+	return func(j *models.Job) { j.MaxAttempts = n }
+}
+
+// RunAfter delays the first attempt.
+func RunAfter(d time.Duration) Option {
+	return func(j *models.Job) { j.RunAt = time.Now().Add(d) }
+}
+
+// UniqueKey makes Enqueue a no-op while another unfinished job has the same key.
+func UniqueKey(key string) Option {
+	return func(j *models.Job) { j.UniqueKey = &key }
+}
+
+// Enqueue stores a new job. The payload is marshalled to JSON.
+func Enqueue(ctx context.Context, jobType string, payload any, opts ...Option) error {
+	return EnqueueTx(db.Conn.WithContext(ctx), jobType, payload, opts...)
+}
+
+// EnqueueTx is Enqueue inside an existing transaction, so a job is only
+// created if the row it refers to is committed too.
+func EnqueueTx(tx *gorm.DB, jobType string, payload any, opts ...Option) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal %s payload: %w", jobType, err)
+	}
+	job := models.Job{
+		Type:        jobType,
+		Payload:     string(data),
+		Status:      models.JobPending,
+		RunAt:       time.Now(),
+		MaxAttempts: 5,
+	}
+	for _, opt := range opts {
+		opt(&job)
+	}
+
+	return tx.Exec(`
+		INSERT INTO jobs (type, payload, status, run_at, max_attempts, unique_key, created_at, updated_at)
+		VALUES (?, ?::jsonb, ?, ?, ?, ?, now(), now())
+		ON CONFLICT (unique_key) WHERE finished_at IS NULL DO NOTHING`,
+		job.Type, job.Payload, job.Status, job.RunAt, job.MaxAttempts, job.UniqueKey).Error
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job goes straight to the dead state.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var perm permanentError
+	return errors.As(err, &perm)
+}
@@ -0,0 +1,71 @@
+// This file schedules recurring maintenance jobs. Every worker pool ticks on
+// its own, but each tick is enqueued with a key for its time slot and only if
+// no job, finished or not, has that key yet, so running several instances
+// still gives one job per interval.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+type periodicJob struct {
+	jobType  string
+	interval time.Duration
+}
+
+var (
+	periodicMu sync.Mutex
+	periodic   []periodicJob
+)
+
+// Every makes worker pools enqueue jobType (with an empty payload) once per
+// interval. The job type still needs a handler.
+func Every(interval time.Duration, jobType string) {
+	periodicMu.Lock()
+	defer periodicMu.Unlock()
+	periodic = append(periodic, periodicJob{jobType: jobType, interval: interval})
+}
+
+func startPeriodic(ctx context.Context) {
+	periodicMu.Lock()
+	defer periodicMu.Unlock()
+	for _, p := range periodic {
+		go p.loop(ctx)
+	}
+}
+
+func (p periodicJob) loop(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		slot := time.Now().Truncate(p.interval).Unix()
+		key := fmt.Sprintf("%s@%d", p.jobType, slot)
+		if err := enqueueSlot(ctx, p.jobType, key); err != nil && ctx.Err() == nil {
+			log.Printf("jobs: scheduling %s failed: %v", p.jobType, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enqueueSlot adds a job for the slot unless one was ever added. The
+// NOT EXISTS sees jobs for the slot that already finished; two instances
+// inserting at once are settled by idx_jobs_unique_active as in Enqueue.
+func enqueueSlot(ctx context.Context, jobType, key string) error {
+	return db.Conn.WithContext(ctx).Exec(`
+		INSERT INTO jobs (type, payload, status, run_at, max_attempts, unique_key, created_at, updated_at)
+		SELECT ?, '{}'::jsonb, ?, now(), 5, ?, now(), now()
+		WHERE NOT EXISTS (SELECT 1 FROM jobs WHERE unique_key = ?)
+		ON CONFLICT (unique_key) WHERE finished_at IS NULL DO NOTHING`,
+		jobType, models.JobPending, key, key).Error
+}
@@ -0,0 +1,206 @@
+// This file is the consumer side of the job queue: a pool of goroutines that
+// claim due jobs with SELECT ... FOR UPDATE SKIP LOCKED, so any number of
+// server or cmd/worker instances can share one table without double-processing.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+// Config controls a worker pool.
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	// Lease is how long a claimed job may run before it is considered
+	// abandoned (e.g. the instance died) and handed to another worker.
+	Lease time.Duration
+}
+
+func (c *Config) defaults() {
+	if c.Workers <= 0 {
+		c.Workers = 2
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = 2 * time.Second
+	}
+	if c.Lease <= 0 {
+		c.Lease = 30 * time.Minute
+	}
+}
+
+// Run starts the pool and blocks until ctx is cancelled and in-flight jobs
+// have returned.
+func Run(ctx context.Context, cfg Config) {
+	cfg.defaults()
+	host, _ := os.Hostname()
+
+	done := make(chan struct{})
+	for i := 0; i < cfg.Workers; i++ {
+		name := fmt.Sprintf("%s/%d/%d", host, os.Getpid(), i)
+		go func() {
+			work(ctx, cfg, name)
+			done <- struct{}{}
+		}()
+	}
+	go reapLoop(ctx, cfg)
+	startPeriodic(ctx)
+
+	log.Printf("jobs: started %d workers for %v", cfg.Workers, registeredTypes())
+	for i := 0; i < cfg.Workers; i++ {
+		<-done
+	}
+}
+
+func work(ctx context.Context, cfg Config, name string) {
+	for {
+		job, err := claim(ctx, name)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("jobs: claim failed: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(cfg.PollInterval):
+				continue
+			}
+		}
+		execute(ctx, cfg, job)
+	}
+}
+
+// claim atomically takes the oldest due job this process has a handler for.
+func claim(ctx context.Context, worker string) (*models.Job, error) {
+	types := registeredTypes()
+	if len(types) == 0 {
+		return nil, nil
+	}
+	var job models.Job
+	res := db.Conn.WithContext(ctx).Raw(`
+		UPDATE jobs
+		SET status = ?, locked_by = ?, locked_at = now(), attempts = attempts + 1, updated_at = now()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_at <= now() AND type IN ?
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING *`,
+		models.JobRunning, worker, models.JobPending, types).Scan(&job)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+func execute(ctx context.Context, cfg Config, job *models.Job) {
+	h, ok := handlerFor(job.Type)
+	if !ok {
+		finish(job, Permanent(fmt.Errorf("no handler for job type %q", job.Type)))
+		return
+	}
+
+	// Keep the handler inside the lease so a slow job is not picked up twice.
+	jobCtx, cancel := context.WithTimeout(ctx, cfg.Lease-time.Minute)
+	defer cancel()
+	jobCtx = context.WithValue(jobCtx, jobKey{}, job)
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return h(jobCtx, job)
+	}()
+	finish(job, err)
+}
+
+type jobKey struct{}
+
+// LastAttempt reports whether the job running in ctx will be marked dead if
+// this attempt fails, so handlers can record a final failure reason.
+func LastAttempt(ctx context.Context) bool {
+	job, ok := ctx.Value(jobKey{}).(*models.Job)
+	return ok && job.Attempts >= job.MaxAttempts
+}
+
+// finish records the outcome of an attempt. It deliberately does not use the
+// worker context so results are saved even while shutting down.
+func finish(job *models.Job, err error) {
+	now := time.Now()
+	updates := map[string]interface{}{"locked_by": "", "locked_at": nil}
+
+	switch {
+	case err == nil:
+		updates["status"] = models.JobSucceeded
+		updates["finished_at"] = now
+		updates["last_error"] = ""
+	case IsPermanent(err) || job.Attempts >= job.MaxAttempts:
+		log.Printf("jobs: %s #%d dead after %d attempts: %v", job.Type, job.ID, job.Attempts, err)
+		updates["status"] = models.JobDead
+		updates["finished_at"] = now
+		updates["last_error"] = err.Error()
+	default:
+		delay := backoff(job.Attempts)
+		log.Printf("jobs: %s #%d attempt %d failed, retrying in %s: %v", job.Type, job.ID, job.Attempts, delay, err)
+		updates["status"] = models.JobPending
+		updates["run_at"] = now.Add(delay)
+		updates["last_error"] = err.Error()
+	}
+
+	if err := db.Conn.Model(&models.Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("jobs: failed to record result for #%d: %v", job.ID, err)
+	}
+}
+
+// backoff is exponential (10s, 20s, 40s, ...) capped at an hour, with jitter
+// so a burst of failures doesn't retry in lockstep.
+func backoff(attempt int) time.Duration {
+	d := 10 * time.Second << (attempt - 1)
+	if d > time.Hour || d <= 0 {
+		d = time.Hour
+	}
+	jitter := time.Duration(rand.Int63n(int64(d / 5)))
+	return d - d/10 + jitter
+}
+
+// reapLoop puts jobs whose lease expired back in the queue, or marks them dead
+// once they have used up their attempts, so a job that keeps crashing its
+// worker doesn't run forever.
+func reapLoop(ctx context.Context, cfg Config) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			res := db.Conn.WithContext(ctx).Exec(`
+				UPDATE jobs SET
+					status = CASE WHEN attempts >= max_attempts THEN ? ELSE ? END,
+					finished_at = CASE WHEN attempts >= max_attempts THEN now() END,
+					last_error = CASE WHEN attempts >= max_attempts THEN 'lease expired' ELSE last_error END,
+					locked_by = '', locked_at = NULL, updated_at = now()
+				WHERE status = ? AND locked_at < ?`,
+				models.JobDead, models.JobPending, models.JobRunning, time.Now().Add(-cfg.Lease))
+			if res.Error != nil && ctx.Err() == nil {
+				log.Printf("jobs: reaping expired leases failed: %v", res.Error)
+			} else if res.RowsAffected > 0 {
+				log.Printf("jobs: reaped %d jobs with expired leases", res.RowsAffected)
+			}
+		}
+	}
+}
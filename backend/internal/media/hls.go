@@ -0,0 +1,237 @@
+// This file turns an uploaded video into an HLS adaptive-bitrate stream: one
+// playlist plus segments per rendition, and a master .m3u8 that points at all
+// of them. Everything is written under the video's derived prefix.
+package media
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/modfy/fluent-ffmpeg"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+// Ladder describes one output rendition.
+type Ladder struct {
+	Name         string
+	Height       int
+	VideoBitrate int // kbps
+	AudioBitrate int // kbps
+}
+
+// DefaultLadder is the set of renditions we try to produce, smallest first.
+var DefaultLadder = []Ladder{
+	{Name: "240p", Height: 240, VideoBitrate: 400, AudioBitrate: 64},
+	{Name: "480p", Height: 480, VideoBitrate: 1000, AudioBitrate: 96},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 160},
+}
+
+const hlsSegmentSeconds = "6"
+
+// HLSPrefix is where the playlists and segments for a video are stored.
+func HLSPrefix(objectName string) string {
+	return DerivedPrefix(objectName) + "hls/"
+}
+
+// laddersFor drops renditions that would upscale the source. The smallest one
+// is always kept so even tiny uploads get a stream.
+func laddersFor(sourceHeight int) []Ladder {
+	var out []Ladder
+	for i, l := range DefaultLadder {
+		if i == 0 || l.Height <= sourceHeight {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// TranscodeAndStoreHLS produces every rendition for a video, records their
+// status on the video, and publishes a master playlist for the ones that worked.
+func TranscodeAndStoreHLS(ctx context.Context, videoID, objectName string) error {
+	setHLSStatus(videoID, models.HLSProcessing, "")
+
+	localPath, err := Download(ctx, objectName)
+	if err != nil {
+		setHLSStatus(videoID, models.HLSFailed, "")
+		return err
+	}
+	defer os.Remove(localPath)
+
+	probe, err := Probe(ctx, localPath)
+	if err != nil {
+		setHLSStatus(videoID, models.HLSFailed, "")
+		return fmt.Errorf("failed to probe video: %v", err)
+	}
+
+	workDir, err := os.MkdirTemp("", "hls-*")
+	if err != nil {
+		setHLSStatus(videoID, models.HLSFailed, "")
+		return fmt.Errorf("failed to create work dir: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// Start from a clean slate so re-runs don't leave stale rows behind.
+	db.Conn.Where("video_id = ?", videoID).Delete(&models.Rendition{})
+
+	ladders := laddersFor(probe.Height)
+	renditions := make([]models.Rendition, len(ladders))
+	for i, l := range ladders {
+		renditions[i] = models.Rendition{
+			VideoID: videoID,
+			Name:    l.Name,
+			Height:  l.Height,
+			Bitrate: l.VideoBitrate + l.AudioBitrate,
+			Status:  models.RenditionPending,
+		}
+	}
+	if err := db.Conn.Create(&renditions).Error; err != nil {
+		setHLSStatus(videoID, models.HLSFailed, "")
+		return fmt.Errorf("failed to record renditions: %v", err)
+	}
+
+	prefix := HLSPrefix(objectName)
+	var ready []models.Rendition
+	for i, l := range ladders {
+		r := &renditions[i]
+		db.Conn.Model(r).Update("status", models.RenditionProcessing)
+
+		width, err := transcodeRendition(ctx, localPath, filepath.Join(workDir, l.Name), prefix+l.Name+"/", l, probe)
+		if err != nil {
+			log.Printf("TranscodeAndStoreHLS: %s rendition for video %s failed: %v", l.Name, videoID, err)
+			db.Conn.Model(r).Updates(map[string]interface{}{"status": models.RenditionFailed, "error": err.Error()})
+			continue
+		}
+
+		r.Width = width
+		r.Playlist = prefix + l.Name + "/index.m3u8"
+		r.Status = models.RenditionReady
+		db.Conn.Model(r).Updates(map[string]interface{}{
+			"width":    r.Width,
+			"playlist": r.Playlist,
+			"status":   r.Status,
+			"error":    "",
+		})
+		ready = append(ready, *r)
+	}
+
+	if len(ready) == 0 {
+		setHLSStatus(videoID, models.HLSFailed, "")
+		return fmt.Errorf("no renditions could be produced")
+	}
+
+	master := prefix + "master.m3u8"
+	if err := writeMasterPlaylist(ctx, master, prefix, ready); err != nil {
+		setHLSStatus(videoID, models.HLSFailed, "")
+		return err
+	}
+	setHLSStatus(videoID, models.HLSReady, master)
+	return nil
+}
+
+// transcodeRendition runs ffmpeg for a single rendition and uploads its
+// playlist and segments. It returns the output width.
+func transcodeRendition(ctx context.Context, input, outDir, objectPrefix string, l Ladder, probe *ProbeResult) (int, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return 0, err
+	}
+
+	// Keep the aspect ratio; libx264 needs an even width.
+	width := l.Height * 16 / 9
+	if probe.Height > 0 {
+		width = probe.Width * l.Height / probe.Height
+	}
+	width -= width % 2
+
+	opts := []string{
+		"-vf", fmt.Sprintf("scale=-2:%d", l.Height),
+		"-b:a", fmt.Sprintf("%dk", l.AudioBitrate),
+		"-sc_threshold", "0",
+		"-hls_time", hlsSegmentSeconds,
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(outDir, "segment_%03d.ts"),
+	}
+	if probe.AudioCodec == "" {
+		opts = append(opts, "-an")
+	}
+
+	var stderr strings.Builder
+	err := fluentffmpeg.NewCommand("").
+		InputPath(input).
+		VideoCodec("libx264").
+		AudioCodec("aac").
+		Preset("veryfast").
+		VideoBitRate(l.VideoBitrate * 1000).
+		VideoMaxBitrate(l.VideoBitrate * 107 / 100).
+		BufferSize(l.VideoBitrate * 3 / 2).
+		KeyframeInterval(48).
+		OutputFormat("hls").
+		OutputOptions(opts...).
+		Overwrite(true).
+		OutputPath(filepath.Join(outDir, "index.m3u8")).
+		OutputLogs(&stderr).
+		RunWithContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("ffmpeg hls transcode failed: %v: %s", err, lastLine(stderr.String()))
+	}
+
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		contentType := "video/mp2t"
+		if path.Ext(e.Name()) == ".m3u8" {
+			contentType = "application/vnd.apple.mpegurl"
+		}
+		if err := upload(ctx, filepath.Join(outDir, e.Name()), objectPrefix+e.Name(), contentType); err != nil {
+			return 0, fmt.Errorf("failed to upload %s: %v", e.Name(), err)
+		}
+	}
+	return width, nil
+}
+
+func writeMasterPlaylist(ctx context.Context, master, prefix string, renditions []models.Rendition) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,NAME=\"%s\"\n", r.Bitrate*1000, r.Width, r.Height, r.Name)
+		b.WriteString(strings.TrimPrefix(r.Playlist, prefix) + "\n")
+	}
+
+	w, err := storage.Store.Create(ctx, master, "application/vnd.apple.mpegurl")
+	if err != nil {
+		return fmt.Errorf("failed to create master playlist: %v", err)
+	}
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		w.Abort()
+		return fmt.Errorf("failed to write master playlist: %v", err)
+	}
+	return w.Close()
+}
+
+func setHLSStatus(videoID, status, playlist string) {
+	updates := map[string]interface{}{"hls_status": status}
+	if playlist != "" {
+		updates["hls_playlist"] = playlist
+	}
+	if err := db.Conn.Model(&models.Video{}).Where("id = ?", videoID).Updates(updates).Error; err != nil {
+		log.Printf("setHLSStatus: video %s: %v", videoID, err)
+	}
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
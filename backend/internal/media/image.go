@@ -0,0 +1,104 @@
+// This file checks images that users upload, such as custom thumbnails and
+// channel banners, before anything else is done with them.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+// Error codes returned when an uploaded image is rejected.
+const (
+	CodeInvalidImage  = "invalid_image"
+	CodeImageTooSmall = "image_too_small"
+	CodeImageTooLarge = "image_too_large"
+)
+
+// ImageLimits bounds what VerifyImage accepts.
+type ImageLimits struct {
+	MaxBytes            int64
+	MinWidth, MinHeight int
+	MaxSide             int // neither dimension may exceed this
+}
+
+// VerifyImage checks that a stored object is a JPEG or PNG within limits and
+// downloads it. The caller removes the returned file. Rejections are returned
+// as *VerifyError.
+func VerifyImage(ctx context.Context, objectName string, limits ImageLimits) (string, error) {
+	attrs, err := storage.Store.Stat(ctx, objectName)
+	if errors.Is(err, storage.ErrNotExist) {
+		return "", &VerifyError{Code: CodeObjectNotFound, Message: "image has not been uploaded"}
+	}
+	if err != nil {
+		return "", err
+	}
+	if limits.MaxBytes > 0 && attrs.Size > limits.MaxBytes {
+		return "", reject(CodeFileTooLarge, "image is %d bytes, the limit is %d", attrs.Size, limits.MaxBytes)
+	}
+
+	localPath, err := Download(ctx, objectName)
+	if err != nil {
+		return "", err
+	}
+	if err := checkImage(localPath, limits); err != nil {
+		os.Remove(localPath)
+		return "", err
+	}
+	return localPath, nil
+}
+
+// checkImage reads only the header, so a small file claiming huge
+// dimensions is turned away before anything allocates its pixels.
+func checkImage(localPath string, limits ImageLimits) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil || (format != "jpeg" && format != "png") {
+		return reject(CodeInvalidImage, "image must be a JPEG or PNG")
+	}
+	if cfg.Width < limits.MinWidth || cfg.Height < limits.MinHeight {
+		return reject(CodeImageTooSmall, "image is %dx%d, at least %dx%d is required", cfg.Width, cfg.Height, limits.MinWidth, limits.MinHeight)
+	}
+	if limits.MaxSide > 0 && (cfg.Width > limits.MaxSide || cfg.Height > limits.MaxSide) {
+		return reject(CodeImageTooLarge, "image is %dx%d, at most %dx%d is allowed", cfg.Width, cfg.Height, limits.MaxSide, limits.MaxSide)
+	}
+	return nil
+}
+
+// imageExt maps the content types we accept for images to a file extension.
+var imageExt = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// ImageExt returns the extension to store an image upload under, or an error
+// if the content type isn't accepted.
+func ImageExt(contentType string) (string, error) {
+	ext, ok := imageExt[contentType]
+	if !ok {
+		return "", fmt.Errorf("image must be a JPEG or PNG")
+	}
+	return ext, nil
+}
+
+// BannerLimits bounds a channel banner upload.
+var BannerLimits = ImageLimits{MaxBytes: 6 << 20, MinWidth: 1024, MinHeight: 256, MaxSide: 8000}
+
+// BannerPrefix is where a user's channel banners are uploaded.
+func BannerPrefix(uid string) string {
+	return "banners/" + uid + "/"
+}
+
+// NewBannerName picks the object name for a new banner upload.
+func NewBannerName(uid, ext string) string {
+	return fmt.Sprintf("%s%d%s", BannerPrefix(uid), time.Now().UnixNano(), ext)
+}
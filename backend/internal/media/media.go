@@ -0,0 +1,137 @@
+// This file holds the helpers shared by every step of the media pipeline:
+// pulling an upload out of the blob store into a temp file, inspecting it
+// with ffprobe, and working out where derived files for a video should live.
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+// ProbeResult is the subset of ffprobe output the pipeline cares about.
+type ProbeResult struct {
+	FormatName string
+	Duration   float64 // seconds
+	Size       int64
+	VideoCodec string
+	AudioCodec string
+	Width      int
+	Height     int
+}
+
+// Probe runs ffprobe against a local path or URL.
+func Probe(ctx context.Context, input string) (*ProbeResult, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-of", "json", "-show_streams", "-show_format", input)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var raw struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+			Size       string `json:"size"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode ffprobe output: %v", err)
+	}
+
+	res := &ProbeResult{FormatName: raw.Format.FormatName}
+	res.Duration, _ = strconv.ParseFloat(raw.Format.Duration, 64)
+	res.Size, _ = strconv.ParseInt(raw.Format.Size, 10, 64)
+	for _, s := range raw.Streams {
+		switch {
+		case s.CodecType == "video" && res.VideoCodec == "":
+			res.VideoCodec, res.Width, res.Height = s.CodecName, s.Width, s.Height
+		case s.CodecType == "audio" && res.AudioCodec == "":
+			res.AudioCodec = s.CodecName
+		}
+	}
+	return res, nil
+}
+
+// ProbeObject runs ffprobe on a stored object without downloading all of it:
+// ffprobe reads the file directly for local storage and fetches only the
+// byte ranges it needs through a signed URL otherwise.
+func ProbeObject(ctx context.Context, objectName string) (*ProbeResult, error) {
+	input, err := probeInput(ctx, objectName)
+	if err != nil {
+		return nil, err
+	}
+	return Probe(ctx, input)
+}
+
+func probeInput(ctx context.Context, objectName string) (string, error) {
+	if local, ok := storage.Store.(*storage.LocalStore); ok {
+		return local.FilePath(objectName)
+	}
+	return storage.Store.SignedGetURL(ctx, objectName, 15*time.Minute)
+}
+
+// Download copies an object into a temp file. The caller removes the file.
+func Download(ctx context.Context, objectName string) (string, error) {
+	tmp, err := os.CreateTemp("", "video-*"+path.Ext(objectName))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp video file: %v", err)
+	}
+	defer tmp.Close()
+
+	reader, err := storage.Store.Open(ctx, objectName)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to open video: %v", err)
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to download video: %v", err)
+	}
+	return tmp.Name(), nil
+}
+
+// DerivedPrefix is the "directory" that files generated from an upload are
+// stored under: videos/<uid>/123-clip.mp4 -> videos/<uid>/123-clip/
+func DerivedPrefix(objectName string) string {
+	return strings.TrimSuffix(objectName, path.Ext(objectName)) + "/"
+}
+
+// upload copies a local file into the blob store.
+func upload(ctx context.Context, localPath, objectName, contentType string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := storage.Store.Create(ctx, objectName, contentType)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
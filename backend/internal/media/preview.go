@@ -0,0 +1,187 @@
+// This file produces the extras the frontend shows while browsing and
+// scrubbing: a short silent loop made of clips from across the video, played
+// when a card is hovered, and a storyboard of small frames taken every few
+// seconds, packed into sprite sheets and indexed by a WebVTT file so the
+// player can show a preview above the seek bar.
+package media
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+const (
+	previewClips       = 4   // clips stitched into the hover preview
+	previewClipSeconds = 1.0 // length of each clip
+	previewWidth       = 320
+	previewFPS         = 12
+
+	storyboardTileWidth = 160
+	storyboardColumns   = 10
+	storyboardRows      = 10
+	storyboardMinStep   = 2.0 // seconds between storyboard frames, at least
+	storyboardMaxFrames = 200 // longer videos get frames further apart
+)
+
+// Previews is where the preview files of a video were stored.
+type Previews struct {
+	MP4URL        string
+	WebPURL       string
+	StoryboardURL string // WebVTT file pointing into the sprite sheets
+}
+
+// PreviewPrefix is where the previews of a video are stored.
+func PreviewPrefix(objectName string) string {
+	return DerivedPrefix(objectName) + "preview/"
+}
+
+// GeneratePreviews renders the hover preview and the storyboard for a video
+// and uploads them under PreviewPrefix.
+func GeneratePreviews(ctx context.Context, objectName string) (*Previews, error) {
+	localPath, err := Download(ctx, objectName)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(localPath)
+
+	probe, err := Probe(ctx, localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe video: %v", err)
+	}
+	if probe.Duration <= 0 || probe.Width <= 0 || probe.Height <= 0 {
+		return nil, fmt.Errorf("video has no duration or size")
+	}
+
+	workDir, err := os.MkdirTemp("", "preview-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	prefix := PreviewPrefix(objectName)
+	if err := renderPreviewLoop(ctx, localPath, workDir, probe.Duration); err != nil {
+		return nil, err
+	}
+	for name, contentType := range map[string]string{"preview.mp4": "video/mp4", "preview.webp": "image/webp"} {
+		if err := upload(ctx, filepath.Join(workDir, name), prefix+name, contentType); err != nil {
+			return nil, fmt.Errorf("failed to upload %s: %v", name, err)
+		}
+	}
+
+	sheets, err := renderStoryboard(ctx, localPath, workDir, probe)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sheets {
+		if err := upload(ctx, filepath.Join(workDir, name), prefix+name, "image/jpeg"); err != nil {
+			return nil, fmt.Errorf("failed to upload %s: %v", name, err)
+		}
+	}
+	if err := upload(ctx, filepath.Join(workDir, "storyboard.vtt"), prefix+"storyboard.vtt", "text/vtt"); err != nil {
+		return nil, fmt.Errorf("failed to upload storyboard.vtt: %v", err)
+	}
+
+	return &Previews{
+		MP4URL:        storage.Store.PublicURL(prefix + "preview.mp4"),
+		WebPURL:       storage.Store.PublicURL(prefix + "preview.webp"),
+		StoryboardURL: storage.Store.PublicURL(prefix + "storyboard.vtt"),
+	}, nil
+}
+
+// renderPreviewLoop writes preview.mp4 and preview.webp: previewClips clips
+// evenly spaced through the video, or the start of it if it is too short for
+// that to be worth it.
+func renderPreviewLoop(ctx context.Context, input, workDir string, duration float64) error {
+	total := previewClips * previewClipSeconds
+	var filter string
+	if duration <= 2*total {
+		filter = fmt.Sprintf("trim=duration=%g,setpts=PTS-STARTPTS", total)
+	} else {
+		// Keep the first second of every duration/previewClips stretch.
+		period := duration / previewClips
+		filter = fmt.Sprintf(`select='lt(mod(t\,%.3f)\,%g)',setpts=N/FRAME_RATE/TB`, period, previewClipSeconds)
+	}
+	filter += fmt.Sprintf(",fps=%d,scale=%d:-2", previewFPS, previewWidth)
+
+	err := runFFmpeg(ctx, "-i", input, "-an", "-vf", filter,
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "30", "-pix_fmt", "yuv420p",
+		"-movflags", "+faststart", filepath.Join(workDir, "preview.mp4"))
+	if err != nil {
+		return fmt.Errorf("ffmpeg preview failed: %v", err)
+	}
+	// The WebP is made from the MP4 so both show exactly the same frames.
+	err = runFFmpeg(ctx, "-i", filepath.Join(workDir, "preview.mp4"),
+		"-c:v", "libwebp", "-loop", "0", "-quality", "60", "-an", filepath.Join(workDir, "preview.webp"))
+	if err != nil {
+		return fmt.Errorf("ffmpeg webp preview failed: %v", err)
+	}
+	return nil
+}
+
+// renderStoryboard writes the sprite sheets and storyboard.vtt, returning the
+// sheet file names.
+func renderStoryboard(ctx context.Context, input, workDir string, probe *ProbeResult) ([]string, error) {
+	step := math.Max(storyboardMinStep, math.Ceil(probe.Duration/storyboardMaxFrames))
+	tileHeight := storyboardTileWidth * probe.Height / probe.Width
+	tileHeight -= tileHeight % 2
+
+	filter := fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d", step, storyboardTileWidth, tileHeight, storyboardColumns, storyboardRows)
+	err := runFFmpeg(ctx, "-i", input, "-an", "-vf", filter, "-q:v", "5", filepath.Join(workDir, "sprite-%03d.jpg"))
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg storyboard failed: %v", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(workDir, "sprite-*.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	sheets := make([]string, len(matches))
+	for i, m := range matches {
+		sheets[i] = filepath.Base(m)
+	}
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no storyboard frames")
+	}
+
+	vtt := storyboardVTT(probe.Duration, step, tileHeight, sheets)
+	if err := os.WriteFile(filepath.Join(workDir, "storyboard.vtt"), []byte(vtt), 0644); err != nil {
+		return nil, err
+	}
+	return sheets, nil
+}
+
+// storyboardVTT maps each step-second stretch of the video to its tile, using
+// media fragments (#xywh=) relative to the VTT file.
+func storyboardVTT(duration, step float64, tileHeight int, sheets []string) string {
+	perSheet := storyboardColumns * storyboardRows
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := 0; float64(i)*step < duration; i++ {
+		sheet := i / perSheet
+		if sheet >= len(sheets) {
+			break
+		}
+		tile := i % perSheet
+		start := float64(i) * step
+		end := math.Min(start+step, duration)
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTime(start), vttTime(end), sheets[sheet],
+			(tile%storyboardColumns)*storyboardTileWidth, (tile/storyboardColumns)*tileHeight,
+			storyboardTileWidth, tileHeight)
+	}
+	return b.String()
+}
+
+func vttTime(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
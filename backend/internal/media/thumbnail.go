@@ -0,0 +1,329 @@
+// This file produces video thumbnails. The pipeline grabs several frames
+// spread over the video, scores each one so near-black, flat or blurry frames
+// lose out, and keeps them all as candidates the owner can choose between.
+// Owners can also upload their own image. Either way the picture is stored in
+// a few widths, as both WebP and JPEG, under the video's derived prefix.
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register decoders for image.Decode
+	_ "image/png"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+// ThumbnailWidths are the sizes every thumbnail is stored in. Widths larger
+// than the source are skipped, except the smallest.
+var ThumbnailWidths = []int{320, 640, 1280}
+
+// thumbnailFormats are the encodings every size is stored in.
+var thumbnailFormats = []struct {
+	ext, contentType string
+	opts             []string
+}{
+	{"webp", "image/webp", []string{"-c:v", "libwebp", "-quality", "80"}},
+	{"jpg", "image/jpeg", []string{"-q:v", "3"}},
+}
+
+const thumbnailCandidates = 5
+
+// scoreWidth is the width images are scored at. Scoring a small copy keeps a
+// large custom upload from being decoded in full on the API server.
+const scoreWidth = 320
+
+// MaxThumbnailBytes bounds a custom thumbnail upload.
+const MaxThumbnailBytes = 5 << 20
+
+var thumbnailLimits = ImageLimits{MaxBytes: MaxThumbnailBytes, MinWidth: 320, MinHeight: 180, MaxSide: 8000}
+
+// ThumbnailPrefix is where the thumbnails of a video are stored.
+func ThumbnailPrefix(objectName string) string {
+	return DerivedPrefix(objectName) + "thumbnails/"
+}
+
+// ThumbnailUploadName picks the object name a custom thumbnail is uploaded
+// to before it is processed. ext includes the dot.
+func ThumbnailUploadName(objectName, ext string) string {
+	return fmt.Sprintf("%supload-%d%s", ThumbnailPrefix(objectName), time.Now().UnixNano(), ext)
+}
+
+// thumbnailObject is one size and format of a thumbnail.
+func thumbnailObject(base string, width int, ext string) string {
+	return fmt.Sprintf("%s-%d.%s", base, width, ext)
+}
+
+// FillThumbnailSources sets the URL of every stored size and format.
+func FillThumbnailSources(t *models.Thumbnail) {
+	t.Sources = t.Sources[:0]
+	for _, w := range t.Widths {
+		for _, f := range thumbnailFormats {
+			t.Sources = append(t.Sources, models.ThumbnailSource{
+				Width:  w,
+				Format: f.ext,
+				URL:    storage.Store.PublicURL(thumbnailObject(t.Base, w, f.ext)),
+			})
+		}
+	}
+}
+
+// thumbnailURL is the JPEG that goes in Video.ThumbnailURL: the 640px one,
+// or the largest below it.
+func thumbnailURL(t *models.Thumbnail) string {
+	best := 0
+	for _, w := range t.Widths {
+		if w <= 640 && w > best || best == 0 {
+			best = w
+		}
+	}
+	return storage.Store.PublicURL(thumbnailObject(t.Base, best, "jpg"))
+}
+
+// FrameScore rates how good a picture is as a thumbnail. Each part is in
+// [0, 1] and Score combines them.
+type FrameScore struct {
+	Brightness float64 // mean luma
+	Entropy    float64 // of the luma histogram, scaled by its 8-bit maximum
+	Sharpness  float64 // from the variance of the Laplacian
+	Score      float64
+}
+
+// ScoreImage looks at the luma of img, sampled down to at most about 320
+// pixels across so large frames cost the same as small ones.
+func ScoreImage(img image.Image) FrameScore {
+	b := img.Bounds()
+	step := max(1, b.Dx()/320)
+	w, h := b.Dx()/step, b.Dy()/step
+	if w < 3 || h < 3 {
+		return FrameScore{}
+	}
+
+	luma := make([]float64, w*h)
+	var hist [256]int
+	var sum float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x*step, b.Min.Y+y*step).RGBA()
+			l := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)) / 257
+			luma[y*w+x] = l
+			hist[int(l)]++
+			sum += l
+		}
+	}
+	n := float64(w * h)
+
+	var s FrameScore
+	s.Brightness = sum / n / 255
+	for _, c := range hist {
+		if c > 0 {
+			p := float64(c) / n
+			s.Entropy -= p * math.Log2(p)
+		}
+	}
+	s.Entropy /= 8
+
+	// Blurry frames have few edges, so the Laplacian barely varies.
+	var lsum, lsq float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			lap := luma[i-w] + luma[i+w] + luma[i-1] + luma[i+1] - 4*luma[i]
+			lsum += lap
+			lsq += lap * lap
+		}
+	}
+	m := float64((w - 2) * (h - 2))
+	variance := lsq/m - (lsum/m)*(lsum/m)
+	s.Sharpness = 1 - math.Exp(-variance/300)
+
+	// Anything between dim and bright is fine; fades to black or white are not.
+	exposure := 1.0
+	switch {
+	case s.Brightness < 0.25:
+		exposure = math.Max(0, (s.Brightness-0.05)/0.2)
+	case s.Brightness > 0.8:
+		exposure = math.Max(0, (0.97-s.Brightness)/0.17)
+	}
+	s.Score = 0.3*exposure + 0.35*s.Entropy + 0.35*s.Sharpness
+	return s
+}
+
+// GenerateThumbnailCandidates grabs frames spread over the video, scores and
+// stores them. The returned thumbnails are not saved to the database.
+func GenerateThumbnailCandidates(ctx context.Context, objectName string) ([]models.Thumbnail, error) {
+	localPath, err := Download(ctx, objectName)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(localPath)
+
+	probe, err := Probe(ctx, localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe video: %v", err)
+	}
+
+	workDir, err := os.MkdirTemp("", "thumbs-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// Frames at 1/6, 2/6, ... 5/6 of the way through, skipping the very start
+	// and end where fades usually are.
+	var out []models.Thumbnail
+	for i := 0; i < thumbnailCandidates; i++ {
+		at := probe.Duration * float64(i+1) / float64(thumbnailCandidates+1)
+		frame := filepath.Join(workDir, fmt.Sprintf("frame-%d.png", i))
+		err := runFFmpeg(ctx, "-ss", fmt.Sprintf("%.3f", at), "-i", localPath, "-frames:v", "1", frame)
+		if err != nil {
+			// A frame near the end of a badly muxed file can be missing;
+			// the others are still worth keeping.
+			if i > 0 && ctx.Err() == nil {
+				continue
+			}
+			return nil, fmt.Errorf("ffmpeg frame extraction failed: %v", err)
+		}
+		t, err := storeThumbnail(ctx, frame, fmt.Sprintf("%scandidate-%d", ThumbnailPrefix(objectName), i))
+		if err != nil {
+			return nil, err
+		}
+		t.Source = models.ThumbnailFrame
+		t.At = math.Round(at*1000) / 1000
+		out = append(out, *t)
+	}
+	return out, nil
+}
+
+// ProcessThumbnailUpload validates a custom image uploaded for the video
+// stored at objectName, stores it in every size and format, and deletes the
+// upload. Rejections are returned as *VerifyError.
+func ProcessThumbnailUpload(ctx context.Context, objectName, uploadName string) (*models.Thumbnail, error) {
+	if !strings.HasPrefix(uploadName, ThumbnailPrefix(objectName)+"upload-") || strings.Contains(uploadName, "..") {
+		return nil, &VerifyError{Code: CodeInvalidObject, Message: "object is not a thumbnail upload for this video"}
+	}
+	defer storage.Store.Delete(ctx, uploadName)
+	localPath, err := VerifyImage(ctx, uploadName, thumbnailLimits)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(localPath)
+
+	base := strings.TrimSuffix(strings.Replace(uploadName, "/upload-", "/custom-", 1), filepath.Ext(uploadName))
+	t, err := storeThumbnail(ctx, localPath, base)
+	if err != nil {
+		return nil, err
+	}
+	t.Source = models.ThumbnailCustom
+	return t, nil
+}
+
+// storeThumbnail scores the image at src and uploads it, resized, under base.
+func storeThumbnail(ctx context.Context, src, base string) (*models.Thumbnail, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		return nil, reject(CodeInvalidImage, "image could not be decoded: %v", err)
+	}
+	srcWidth, srcHeight := cfg.Width, cfg.Height
+
+	t := &models.Thumbnail{
+		Base:   base,
+		Width:  srcWidth,
+		Height: srcHeight,
+	}
+	for i, w := range ThumbnailWidths {
+		if i == 0 || w <= srcWidth {
+			t.Widths = append(t.Widths, w)
+		}
+	}
+
+	// One ffmpeg run writes every size and format, and the copy to score.
+	dir := filepath.Dir(src)
+	stem := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	args := []string{"-i", src}
+	for _, w := range t.Widths {
+		for _, f := range thumbnailFormats {
+			args = append(args, "-vf", fmt.Sprintf("scale=%d:-2", w), "-frames:v", "1")
+			args = append(args, f.opts...)
+			args = append(args, filepath.Join(dir, fmt.Sprintf("%s-%d.%s", stem, w, f.ext)))
+		}
+	}
+	scored := filepath.Join(dir, stem+"-score.png")
+	args = append(args, "-vf", fmt.Sprintf("scale=%d:-2", min(scoreWidth, srcWidth)), "-frames:v", "1", scored)
+	err = runFFmpeg(ctx, args...)
+	defer os.Remove(scored)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg thumbnail resize failed: %v", err)
+	}
+	score, err := scoreFile(scored)
+	if err != nil {
+		return nil, err
+	}
+	t.Brightness, t.Entropy, t.Sharpness, t.Score = score.Brightness, score.Entropy, score.Sharpness, score.Score
+
+	for _, w := range t.Widths {
+		for _, f := range thumbnailFormats {
+			local := filepath.Join(dir, fmt.Sprintf("%s-%d.%s", stem, w, f.ext))
+			err := upload(ctx, local, thumbnailObject(base, w, f.ext), f.contentType)
+			os.Remove(local)
+			if err != nil {
+				return nil, fmt.Errorf("failed to upload thumbnail: %v", err)
+			}
+		}
+	}
+	return t, nil
+}
+
+// scoreFile decodes and scores the image at path.
+func scoreFile(path string) (FrameScore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FrameScore{}, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return FrameScore{}, reject(CodeInvalidImage, "image could not be decoded: %v", err)
+	}
+	return ScoreImage(img), nil
+}
+
+func runFFmpeg(ctx context.Context, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", append([]string{"-y", "-v", "error"}, args...)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+// SelectThumbnail makes t the video's thumbnail.
+func SelectThumbnail(tx *gorm.DB, t *models.Thumbnail) error {
+	err := tx.Model(&models.Thumbnail{}).
+		Where("video_id = ? AND selected AND id <> ?", t.VideoID, t.ID).
+		Update("selected", false).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(t).Update("selected", true).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Video{}).Where("id = ?", t.VideoID).Update("thumbnail_url", thumbnailURL(t)).Error
+}
@@ -0,0 +1,130 @@
+// This file checks that a finalized upload is what the client claims: an
+// object it uploaded itself, within the size and duration limits, in a
+// container and codecs we can process.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+// Error codes returned to the client when an upload is rejected.
+const (
+	CodeInvalidObject        = "invalid_object"
+	CodeObjectNotFound       = "object_not_found"
+	CodeFileTooLarge         = "file_too_large"
+	CodeInvalidMedia         = "invalid_media"
+	CodeNoVideoStream        = "no_video_stream"
+	CodeUnsupportedContainer = "unsupported_container"
+	CodeUnsupportedCodec     = "unsupported_codec"
+	CodeDurationTooLong      = "duration_too_long"
+)
+
+// VerifyError is a rejected upload.
+type VerifyError struct {
+	Code    string
+	Message string
+	// Content is set when the object exists and belongs to the caller but its
+	// contents are unacceptable, i.e. it should be quarantined or deleted.
+	Content bool
+}
+
+func (e *VerifyError) Error() string { return e.Code + ": " + e.Message }
+
+func reject(code, format string, args ...any) *VerifyError {
+	return &VerifyError{Code: code, Message: fmt.Sprintf(format, args...), Content: true}
+}
+
+// Limits bounds what VerifyUpload accepts.
+type Limits struct {
+	MaxBytes    int64
+	MaxDuration time.Duration
+}
+
+var (
+	// ffprobe reports format_name as a comma-separated list of aliases.
+	allowedContainers = []string{"mov", "mp4", "matroska", "webm", "avi"}
+	allowedVideo      = map[string]bool{"h264": true, "hevc": true, "vp8": true, "vp9": true, "av1": true, "mpeg4": true}
+	allowedAudio      = map[string]bool{"": true, "aac": true, "mp3": true, "opus": true, "vorbis": true}
+)
+
+// UploadPrefix is where a user's uploads must live. Uploads sit directly
+// under it; deeper names are files derived from an upload (see DerivedPrefix).
+func UploadPrefix(uid string) string {
+	return "videos/" + uid + "/"
+}
+
+// NewUploadName picks the object name for a new upload of fileName.
+func NewUploadName(uid, fileName string) string {
+	return fmt.Sprintf("%s%d-%s", UploadPrefix(uid), time.Now().Unix(), path.Base(fileName))
+}
+
+// VerifyUpload checks an object named by the client before a video record is
+// created for it. Errors other than *VerifyError are infrastructure failures.
+func VerifyUpload(ctx context.Context, uid, objectName string, limits Limits) (*ProbeResult, error) {
+	if path.Clean(objectName) != objectName || !strings.HasPrefix(objectName, UploadPrefix(uid)) {
+		return nil, &VerifyError{Code: CodeInvalidObject, Message: "object does not belong to this user"}
+	}
+	// HLS segments, thumbnails and previews share the prefix. Finalizing one
+	// would fail verification and get a live file discarded.
+	if path.Dir(objectName)+"/" != UploadPrefix(uid) {
+		return nil, &VerifyError{Code: CodeInvalidObject, Message: "object is not an upload"}
+	}
+
+	attrs, err := storage.Store.Stat(ctx, objectName)
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil, &VerifyError{Code: CodeObjectNotFound, Message: "object has not been uploaded"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && attrs.Size > limits.MaxBytes {
+		return nil, reject(CodeFileTooLarge, "file is %d bytes, the limit is %d", attrs.Size, limits.MaxBytes)
+	}
+
+	res, err := ProbeObject(ctx, objectName)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, reject(CodeInvalidMedia, "file could not be read as a video")
+	}
+	if res.VideoCodec == "" {
+		return nil, reject(CodeNoVideoStream, "file has no video stream")
+	}
+	if !containerAllowed(res.FormatName) {
+		return nil, reject(CodeUnsupportedContainer, "container %q is not supported", res.FormatName)
+	}
+	if !allowedVideo[res.VideoCodec] {
+		return nil, reject(CodeUnsupportedCodec, "video codec %q is not supported", res.VideoCodec)
+	}
+	if !allowedAudio[res.AudioCodec] {
+		return nil, reject(CodeUnsupportedCodec, "audio codec %q is not supported", res.AudioCodec)
+	}
+	if limits.MaxDuration > 0 && res.Duration > limits.MaxDuration.Seconds() {
+		return nil, reject(CodeDurationTooLong, "video is %.0fs long, the limit is %.0fs", res.Duration, limits.MaxDuration.Seconds())
+	}
+	return res, nil
+}
+
+func containerAllowed(formatName string) bool {
+	for _, name := range strings.Split(formatName, ",") {
+		for _, ok := range allowedContainers {
+			if name == ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// QuarantineName is where a rejected upload is moved for later inspection.
+func QuarantineName(objectName string) string {
+	return "quarantine/" + strings.TrimPrefix(objectName, "videos/")
+}
@@ -39,6 +39,12 @@ func InitRateLimiter(redisURL string, redisDB int) error {
 	return nil
 }
 
+// Redis returns the client set up by InitRateLimiter, or nil if rate
+// limiting is off, so other features can share the connection.
+func Redis() *redis.Client {
+	return rdb
+}
+
 // RateLimitByIP creates a rate limiting middleware based on client IP
 func RateLimitByIP(limit int, window time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -203,6 +209,10 @@ func handleRateLimitExceeded(c *gin.Context, res *redis_rate.Result) {
 
 // WebSocket connection limiting functions
 
+// wsKeyTTL bounds how long a connection key outlives its socket if the
+// instance holding it dies. Live sockets refresh it on every pong.
+const wsKeyTTL = 3 * time.Minute
+
 // CheckWebSocketLimit checks if a user can establish a WebSocket connection for a video
 func CheckWebSocketLimit(userID, videoID string) (bool, error) {
 	if rdb == nil {
@@ -222,8 +232,8 @@ func CheckWebSocketLimit(userID, videoID string) (bool, error) {
 		return false, nil // Connection already exists
 	}
 
-	// Allow connection and set key with 1 hour expiry
-	err = rdb.Set(ctx, key, "1", time.Hour).Err()
+	// Allow connection; the socket's heartbeat keeps the key alive
+	err = rdb.Set(ctx, key, "1", wsKeyTTL).Err()
 	return err == nil, err
 }
 
@@ -246,5 +256,62 @@ func RefreshWebSocketLimit(userID, videoID string) error {
 
 	ctx := context.Background()
 	key := fmt.Sprintf("ws:user:%s:video:%s", userID, videoID)
-	return rdb.Expire(ctx, key, time.Hour).Err()
-}
\ No newline at end of file
+	return rdb.Expire(ctx, key, wsKeyTTL).Err()
+}
+
+// MaxAnonymousSockets is how many anonymous WebSocket connections one IP may
+// hold at once, across all videos. It is generous because many viewers can
+// share an address behind NAT.
+const MaxAnonymousSockets = 20
+
+// CheckWebSocketIPLimit counts an anonymous WebSocket connection from ip,
+// reporting false if the IP already holds MaxAnonymousSockets
+func CheckWebSocketIPLimit(ip string) (bool, error) {
+	if rdb == nil {
+		return true, nil // Rate limiting disabled
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("ws:ip:%s", ip)
+
+	n, err := rdb.Incr(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	if n > MaxAnonymousSockets {
+		rdb.Decr(ctx, key)
+		return false, nil
+	}
+	// The count only outlives its sockets if this instance dies; keep it
+	// from lingering longer than a connection key would
+	err = rdb.Expire(ctx, key, wsKeyTTL).Err()
+	return err == nil, err
+}
+
+// ReleaseWebSocketIPLimit uncounts an anonymous WebSocket connection
+func ReleaseWebSocketIPLimit(ip string) error {
+	if rdb == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("ws:ip:%s", ip)
+	n, err := rdb.Decr(ctx, key).Result()
+	if err == nil && n <= 0 {
+		// Last one out, or the count already expired and DECR recreated it
+		// without a TTL
+		err = rdb.Del(ctx, key).Err()
+	}
+	return err
+}
+
+// RefreshWebSocketIPLimit refreshes the TTL of an IP's anonymous connection count
+func RefreshWebSocketIPLimit(ip string) error {
+	if rdb == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("ws:ip:%s", ip)
+	return rdb.Expire(ctx, key, wsKeyTTL).Err()
+}
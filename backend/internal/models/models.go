@@ -7,40 +7,357 @@ package models
 import "time"
 
 type User struct {
-	ID        string    `gorm:"primaryKey" json:"ID"`
-	Email     string    `gorm:"uniqueIndex;size:255" json:"Email"`
-	Username  string    `gorm:"uniqueIndex;size:50" json:"Username"`
-	AvatarURL string    `json:"AvatarURL"`
-	CreatedAt time.Time `json:"CreatedAt"`
+	ID        string        `gorm:"primaryKey" json:"ID"`
+	Email     string        `gorm:"uniqueIndex;size:255" json:"Email"`
+	Username  string        `gorm:"uniqueIndex;size:50" json:"Username"`
+	AvatarURL string        `json:"AvatarURL"`
+	Bio       string        `gorm:"type:text" json:"Bio"`
+	BannerURL string        `gorm:"type:text" json:"BannerURL"`
+	Links     []ProfileLink `gorm:"serializer:json;type:jsonb" json:"Links"`
+	// BlockedTerms hold comments on this user's videos for review. Only the
+	// owner sees them, through /v1/profile/blocked-terms.
+	BlockedTerms []string  `gorm:"serializer:json;type:jsonb" json:"-"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+}
+
+// ProfileLink is one of the links shown on a user's channel page.
+type ProfileLink struct {
+	Title string `json:"Title"`
+	URL   string `json:"URL"`
 }
 
 type Video struct {
-	ID           string    `gorm:"primaryKey" json:"ID"`
-	UserID       string    `gorm:"index" json:"UserID"`
-	Title        string    `gorm:"size:120" json:"Title"`
-	Description  string    `gorm:"type:text" json:"Description"`
-	ThumbnailURL string    `gorm:"type:text" json:"ThumbnailURL"`
-	ObjectName   string    `json:"ObjectName"`
-	Summary      string    `gorm:"type:text" json:"Summary"`
-	SummaryModel string    `gorm:"size:50" json:"SummaryModel"`
-	Views        int64     `json:"Views"`
-	CreatedAt    time.Time `json:"CreatedAt"`
-	User         *User     `gorm:"foreignKey:UserID" json:"User"`
-	Comments     []Comment `json:"Comments"`
-	Likes        int       `gorm:"-" json:"Likes"`
-	IsLiked      bool      `gorm:"-" json:"IsLiked"`
+	ID             string         `gorm:"primaryKey" json:"ID"`
+	UserID         string         `gorm:"index" json:"UserID"`
+	Title          string         `gorm:"size:120" json:"Title"`
+	Description    string         `gorm:"type:text" json:"Description"`
+	ThumbnailURL   string         `gorm:"type:text" json:"ThumbnailURL"`
+	ObjectName     string         `gorm:"uniqueIndex:idx_videos_object_name" json:"ObjectName"`
+	Summary        string         `gorm:"type:text" json:"Summary"`
+	SummaryModel   string         `gorm:"size:50" json:"SummaryModel"`
+	Views          int64          `json:"Views"`
+	Status         string         `gorm:"size:20;not null;default:ready;index" json:"Status"`
+	Visibility     string         `gorm:"size:10;not null;default:public" json:"Visibility"`
+	PublishAt      *time.Time     `json:"PublishAt,omitempty"` // when a scheduled video goes public
+	FailureReason  string         `gorm:"type:text" json:"FailureReason,omitempty"`
+	Duration       float64        `json:"Duration"` // seconds
+	Width          int            `json:"Width"`
+	Height         int            `json:"Height"`
+	HLSStatus      string         `gorm:"size:20" json:"HLSStatus"`
+	HLSPlaylist    string         `json:"-"`                                                                 // object name of the master .m3u8
+	PreviewURL     string         `gorm:"type:text" json:"PreviewURL,omitempty"`                             // silent MP4 loop for hover previews
+	PreviewWebPURL string         `gorm:"column:preview_webp_url;type:text" json:"PreviewWebPURL,omitempty"` // the same loop as an animated WebP
+	StoryboardURL  string         `gorm:"type:text" json:"StoryboardURL,omitempty"`                          // WebVTT index into seek-bar sprite sheets
+	CreatedAt      time.Time      `json:"CreatedAt"`
+	DeletedAt      *time.Time     `json:"DeletedAt,omitempty"` // set while the video waits to be purged
+	User           *User          `gorm:"foreignKey:UserID" json:"User"`
+	Comments       []Comment      `json:"Comments"`
+	Renditions     []Rendition    `json:"Renditions,omitempty"`
+	Steps          []VideoStep    `json:"Steps,omitempty"`
+	Tags           []VideoTag     `json:"Tags,omitempty"`
+	Analysis       *VideoAnalysis `json:"Analysis,omitempty"`
+	Thumbnail      *Thumbnail     `gorm:"-" json:"Thumbnail,omitempty"` // the selected one, with its sources
+	Likes          int            `gorm:"-" json:"Likes"`
+	IsLiked        bool           `gorm:"-" json:"IsLiked"`
+	PlaylistURL    string         `gorm:"-" json:"PlaylistURL,omitempty"`
 }
 
-type Comment struct {
+// Video visibility values. Public videos are listed and searchable, unlisted
+// ones can be watched by anyone with the link, private ones only by their
+// owner. Scheduled videos are private until PublishAt and public after.
+const (
+	VisibilityPublic    = "public"
+	VisibilityUnlisted  = "unlisted"
+	VisibilityPrivate   = "private"
+	VisibilityScheduled = "scheduled"
+)
+
+// Video status values. A video moves uploaded -> probing -> processing and
+// then ends up ready or failed. Only ready videos are listed publicly. A
+// deleted video is moved to purging once the purge job starts removing it.
+const (
+	VideoUploaded   = "uploaded"
+	VideoProbing    = "probing"
+	VideoProcessing = "processing"
+	VideoReady      = "ready"
+	VideoFailed     = "failed"
+	VideoPurging    = "purging"
+)
+
+// VideoStep tracks one processing step of a video and why it failed.
+type VideoStep struct {
+	VideoID   string    `gorm:"primaryKey" json:"-"`
+	Name      string    `gorm:"primaryKey;size:20" json:"Name"`
+	Status    string    `gorm:"size:20" json:"Status"`
+	Error     string    `gorm:"type:text" json:"Error,omitempty"`
+	Attempts  int       `json:"Attempts"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+}
+
+// Processing steps.
+const (
+	StepProbe     = "probe"
+	StepThumbnail = "thumbnail"
+	StepTranscode = "transcode"
+	StepPreview   = "preview"
+	StepSummary   = "summary"
+)
+
+// Step status values.
+const (
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+)
+
+// HLS status values for Video.HLSStatus.
+const (
+	HLSPending    = "pending"
+	HLSProcessing = "processing"
+	HLSReady      = "ready"
+	HLSFailed     = "failed"
+)
+
+// Rendition is one HLS quality level of a video (240p, 480p, ...).
+type Rendition struct {
 	ID        uint      `gorm:"primaryKey" json:"ID"`
-	UserID    string    `json:"UserID"`
 	VideoID   string    `gorm:"index" json:"VideoID"`
-	Message   string    `gorm:"type:text" json:"Message"`
-	CreatedAt time.Time `json:"CreatedAt"`
-	User      User      `gorm:"foreignKey:UserID" json:"User"`
+	Name      string    `gorm:"size:10" json:"Name"`
+	Width     int       `json:"Width"`
+	Height    int       `json:"Height"`
+	Bitrate   int       `json:"Bitrate"` // kbps, video + audio
+	Playlist  string    `json:"-"`       // object name of the rendition .m3u8
+	Status    string    `gorm:"size:20" json:"Status"`
+	Error     string    `gorm:"type:text" json:"Error,omitempty"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+}
+
+// Rendition status values.
+const (
+	RenditionPending    = "pending"
+	RenditionProcessing = "processing"
+	RenditionReady      = "ready"
+	RenditionFailed     = "failed"
+)
+
+// Thumbnail is a picture that can be shown for a video: either a frame the
+// pipeline picked out, or an image the owner uploaded. Each one is stored in
+// every width in Widths, as both WebP and JPEG.
+type Thumbnail struct {
+	ID         uint              `gorm:"primaryKey" json:"ID"`
+	VideoID    string            `gorm:"index;not null" json:"VideoID"`
+	Source     string            `gorm:"size:10;not null" json:"Source"`
+	At         float64           `json:"At,omitempty"`                // seconds into the video, for frames
+	Base       string            `gorm:"type:text;not null" json:"-"` // object name without the -<width>.<ext> suffix
+	Width      int               `json:"Width"`
+	Height     int               `json:"Height"`
+	Widths     []int             `gorm:"serializer:json;type:jsonb" json:"Widths"`
+	Brightness float64           `json:"Brightness"`
+	Entropy    float64           `json:"Entropy"`
+	Sharpness  float64           `json:"Sharpness"`
+	Score      float64           `json:"Score"`
+	Selected   bool              `gorm:"not null;default:false" json:"Selected"`
+	CreatedAt  time.Time         `json:"CreatedAt"`
+	Sources    []ThumbnailSource `gorm:"-" json:"Sources"`
+}
+
+// ThumbnailSource is one stored size and format of a thumbnail.
+type ThumbnailSource struct {
+	Width  int    `json:"Width"`
+	Format string `json:"Format"` // "webp" or "jpg"
+	URL    string `json:"URL"`
+}
+
+// Thumbnail sources.
+const (
+	ThumbnailFrame  = "frame"
+	ThumbnailCustom = "custom"
+)
+
+// Comment is a comment on a video, or a reply when ParentID is set. Replies
+// can be nested. A deleted comment that has replies stays behind with an
+// empty message so the thread keeps its shape.
+type Comment struct {
+	ID         uint       `gorm:"primaryKey" json:"ID"`
+	UserID     string     `json:"UserID"`
+	VideoID    string     `gorm:"index" json:"VideoID"`
+	ParentID   *uint      `gorm:"index" json:"ParentID"`
+	Message    string     `gorm:"type:text" json:"Message"`
+	CreatedAt  time.Time  `json:"CreatedAt"`
+	EditedAt   *time.Time `json:"EditedAt,omitempty"`
+	DeletedAt  *time.Time `json:"DeletedAt,omitempty"`
+	Status     string     `gorm:"size:10;default:published" json:"Status"`
+	HeldReason string     `json:"HeldReason,omitempty"` // why moderation held it
+	User       User       `gorm:"foreignKey:UserID" json:"User"`
+	ReplyCount int        `gorm:"-" json:"ReplyCount"`
+}
+
+// Comment statuses. Only published comments are listed; held ones wait in
+// the video's moderation queue.
+const (
+	CommentPublished = "published"
+	CommentHeld      = "held"
+)
+
+// CommentEdit is an earlier version of an edited comment.
+type CommentEdit struct {
+	ID        uint      `gorm:"primaryKey" json:"ID"`
+	CommentID uint      `gorm:"index" json:"CommentID"`
+	Message   string    `gorm:"type:text" json:"Message"` // the text before the edit
+	CreatedAt time.Time `json:"CreatedAt"`                // when it was replaced
 }
 
 type Like struct {
 	UserID  string `gorm:"primaryKey" json:"UserID"`
 	VideoID string `gorm:"primaryKey" json:"VideoID"`
 }
+
+// Playlist is an ordered list of videos made by a user. Every user also has
+// one built-in Watch later playlist, created the first time it is used.
+type Playlist struct {
+	ID          string         `gorm:"primaryKey" json:"ID"`
+	UserID      string         `gorm:"index" json:"UserID"`
+	Title       string         `gorm:"size:150" json:"Title"`
+	Description string         `gorm:"type:text" json:"Description"`
+	Visibility  string         `gorm:"size:10;not null;default:private" json:"Visibility"`
+	Kind        string         `gorm:"size:20;not null;default:''" json:"Kind,omitempty"` // "" or PlaylistWatchLater
+	CreatedAt   time.Time      `json:"CreatedAt"`
+	UpdatedAt   time.Time      `json:"UpdatedAt"`
+	User        *User          `gorm:"foreignKey:UserID" json:"User,omitempty"`
+	Items       []PlaylistItem `json:"Items,omitempty"`
+	ItemCount   int            `gorm:"-" json:"ItemCount"`
+}
+
+// Playlist visibility values. Public playlists are listed on the owner's
+// channel, unlisted ones can be opened by anyone with the link, and private
+// ones only by the owner.
+const (
+	PlaylistPublic   = "public"
+	PlaylistUnlisted = "unlisted"
+	PlaylistPrivate  = "private"
+)
+
+// PlaylistWatchLater is the Kind of each user's Watch later playlist.
+const PlaylistWatchLater = "watch_later"
+
+// PlaylistItem is a video in a playlist. Items are ordered by Position, a
+// float so an item can be moved between two others by taking the midpoint
+// instead of renumbering the whole list.
+type PlaylistItem struct {
+	ID         uint      `gorm:"primaryKey" json:"ID"`
+	PlaylistID string    `gorm:"index" json:"PlaylistID"`
+	VideoID    string    `json:"VideoID"`
+	Position   float64   `json:"Position"`
+	CreatedAt  time.Time `json:"CreatedAt"`
+	Video      *Video    `gorm:"foreignKey:VideoID" json:"Video,omitempty"`
+}
+
+// Subscription is a user following a channel (another user).
+type Subscription struct {
+	SubscriberID string    `gorm:"primaryKey" json:"SubscriberID"`
+	ChannelID    string    `gorm:"primaryKey;index" json:"ChannelID"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+}
+
+// Job is a unit of background work in the Postgres-backed queue (see internal/jobs).
+type Job struct {
+	ID          uint       `gorm:"primaryKey" json:"ID"`
+	Type        string     `gorm:"size:50;index" json:"Type"`
+	Payload     string     `gorm:"type:jsonb;not null;default:'{}'" json:"Payload"`
+	Status      string     `gorm:"size:20;not null;index:idx_jobs_runnable,priority:1" json:"Status"`
+	RunAt       time.Time  `gorm:"not null;index:idx_jobs_runnable,priority:2" json:"RunAt"`
+	Attempts    int        `gorm:"not null;default:0" json:"Attempts"`
+	MaxAttempts int        `gorm:"not null;default:5" json:"MaxAttempts"`
+	LastError   string     `gorm:"type:text" json:"LastError"`
+	UniqueKey   *string    `gorm:"size:200;uniqueIndex:idx_jobs_unique_active,where:finished_at IS NULL;index:idx_jobs_unique_key" json:"UniqueKey"`
+	LockedBy    string     `gorm:"size:100" json:"LockedBy"`
+	LockedAt    *time.Time `json:"LockedAt"`
+	FinishedAt  *time.Time `json:"FinishedAt"`
+	CreatedAt   time.Time  `json:"CreatedAt"`
+	UpdatedAt   time.Time  `json:"UpdatedAt"`
+}
+
+// Job status values. Failed attempts go back to pending until MaxAttempts is
+// reached, after which the job is parked as dead for manual inspection.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// UploadSession tracks a resumable upload so the client can find out how much
+// arrived and carry on after a dropped connection.
+type UploadSession struct {
+	ID          string    `gorm:"primaryKey" json:"ID"`
+	UserID      string    `gorm:"index" json:"UserID"`
+	ObjectName  string    `gorm:"index" json:"ObjectName"`
+	ContentType string    `json:"ContentType"`
+	Size        int64     `json:"Size"`
+	Offset      int64     `json:"Offset"`
+	Protocol    string    `gorm:"size:20" json:"Protocol"`
+	SessionURL  string    `gorm:"type:text" json:"-"` // GCS resumable session URI
+	Status      string    `gorm:"size:20;not null;index" json:"Status"`
+	ExpiresAt   time.Time `gorm:"index" json:"ExpiresAt"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+	UpdatedAt   time.Time `json:"UpdatedAt"`
+}
+
+// Upload protocols and session status values.
+const (
+	UploadProtocolGCS = "gcs-resumable"
+	UploadProtocolTus = "tus"
+
+	UploadActive    = "active"
+	UploadCompleted = "completed" // every byte received, waiting for finalize-upload
+	UploadFinalized = "finalized" // a video record owns the object
+	UploadExpired   = "expired"
+	UploadCancelled = "cancelled"
+)
+
+// VideoAnalysis holds the structured AI output for a video that doesn't fit
+// in a list of its own.
+type VideoAnalysis struct {
+	VideoID       string    `gorm:"primaryKey" json:"-"`
+	Model         string    `gorm:"size:50" json:"Model"`
+	SafetyRating  string    `gorm:"size:20;index" json:"SafetyRating"`
+	SafetyReasons []string  `gorm:"serializer:json;type:jsonb" json:"SafetyReasons"`
+	Language      string    `gorm:"size:20" json:"Language,omitempty"`
+	UpdatedAt     time.Time `json:"UpdatedAt"`
+}
+
+// Content-safety ratings, from suitable for everyone to not suitable for
+// the site.
+const (
+	SafetyGeneral    = "general"
+	SafetyTeen       = "teen"
+	SafetyMature     = "mature"
+	SafetyRestricted = "restricted"
+)
+
+// Chapter is a titled section of a video.
+type Chapter struct {
+	ID       uint    `gorm:"primaryKey" json:"-"`
+	VideoID  string  `gorm:"index" json:"-"`
+	Position int     `json:"Position"`
+	Start    float64 `json:"Start"` // seconds
+	Title    string  `gorm:"size:200" json:"Title"`
+}
+
+// VideoTag is a topical tag on a video.
+type VideoTag struct {
+	VideoID string `gorm:"primaryKey" json:"-"`
+	Tag     string `gorm:"primaryKey;size:50;index" json:"Tag"`
+}
+
+// TranscriptSegment is a timed piece of a video's transcript.
+type TranscriptSegment struct {
+	ID       uint    `gorm:"primaryKey" json:"-"`
+	VideoID  string  `gorm:"index" json:"-"`
+	Position int     `json:"Position"`
+	Start    float64 `json:"Start"`
+	End      float64 `json:"End"`
+	Text     string  `gorm:"type:text" json:"Text"`
+}
@@ -0,0 +1,182 @@
+// Package moderation decides what happens to a comment before it is saved:
+// publish it, hold it for the video owner to review, or reject it outright.
+// Checks run from cheapest to dearest and the first one that objects wins:
+//
+//   - the site-wide blocklist (MODERATION_BLOCKLIST) rejects;
+//   - the channel owner's blocked terms hold;
+//   - more than MODERATION_MAX_LINKS links hold;
+//   - with MODERATION_AI=true, the AI provider's toxicity score holds or
+//     rejects past MODERATION_HOLD_SCORE and MODERATION_REJECT_SCORE.
+//
+// The blocklist file has one entry per line. Plain entries match whole words
+// and phrases regardless of case; entries written as /pattern/ are regular
+// expressions (add (?i) for case-insensitive ones). Blank lines and lines
+// starting with # are skipped.
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/ai"
+	"github.com/hi-wesley/mini-youtube/internal/config"
+)
+
+// Outcome is what happens to a comment.
+type Outcome string
+
+const (
+	Publish Outcome = "publish"
+	Hold    Outcome = "hold"
+	Reject  Outcome = "reject"
+)
+
+// Decision is an outcome and, unless it is Publish, why.
+type Decision struct {
+	Outcome Outcome
+	Reason  string
+}
+
+// scoreTimeout bounds the AI call, which the commenter waits for.
+const scoreTimeout = 5 * time.Second
+
+// linkPattern finds things people would follow as links.
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://|\bwww\.`)
+
+// Moderator holds the site-wide rules.
+type Moderator struct {
+	blocked     []*regexp.Regexp
+	maxLinks    int
+	scorer      ai.Summarizer // nil when AI scoring is off
+	holdScore   float64
+	rejectScore float64
+}
+
+// Default is the process-wide moderator, set up by Init. Until then every
+// comment is published.
+var Default = &Moderator{maxLinks: -1}
+
+// Init builds Default from cfg, scoring with scorer when AI moderation is on.
+func Init(cfg *config.Config, scorer ai.Summarizer) error {
+	m := &Moderator{
+		maxLinks:    cfg.ModerationMaxLinks,
+		holdScore:   cfg.ModerationHoldScore,
+		rejectScore: cfg.ModerationRejectScore,
+	}
+	if cfg.ModerationBlocklist != "" {
+		blocked, err := loadBlocklist(cfg.ModerationBlocklist)
+		if err != nil {
+			return err
+		}
+		m.blocked = blocked
+	}
+	if cfg.ModerationAI {
+		if scorer == nil {
+			log.Printf("moderation: MODERATION_AI is set but AI_PROVIDER=none, comments won't be scored")
+		}
+		m.scorer = scorer
+	}
+	Default = m
+	return nil
+}
+
+func loadBlocklist(path string) ([]*regexp.Regexp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("moderation blocklist: %w", err)
+	}
+	defer f.Close()
+
+	var out []*regexp.Regexp
+	var words []string
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		entry := strings.TrimSpace(sc.Text())
+		switch {
+		case entry == "" || strings.HasPrefix(entry, "#"):
+		case len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/"):
+			re, err := regexp.Compile(entry[1 : len(entry)-1])
+			if err != nil {
+				return nil, fmt.Errorf("moderation blocklist %s:%d: %w", path, line, err)
+			}
+			out = append(out, re)
+		default:
+			words = append(words, entry)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("moderation blocklist: %w", err)
+	}
+	if re := wordsPattern(words); re != nil {
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+// wordsPattern matches any of words as a whole word or phrase, ignoring
+// case. It returns nil for no words.
+func wordsPattern(words []string) *regexp.Regexp {
+	var alts []string
+	for _, w := range words {
+		// Words in a phrase may be separated by any run of whitespace.
+		var parts []string
+		for _, f := range strings.Fields(w) {
+			parts = append(parts, regexp.QuoteMeta(f))
+		}
+		if len(parts) > 0 {
+			alts = append(alts, strings.Join(parts, `\s+`))
+		}
+	}
+	if len(alts) == 0 {
+		return nil
+	}
+	// \b only sits next to word characters, so terms that start or end
+	// with punctuation are bounded by anything that isn't a word character.
+	return regexp.MustCompile(`(?i)(?:^|\W)(?:` + strings.Join(alts, "|") + `)(?:\W|$)`)
+}
+
+// Check decides on a comment for a channel whose owner blocked
+// channelTerms.
+func (m *Moderator) Check(ctx context.Context, message string, channelTerms []string) Decision {
+	for _, re := range m.blocked {
+		if re.MatchString(message) {
+			return Decision{Reject, "contains a blocked word"}
+		}
+	}
+	if re := wordsPattern(channelTerms); re != nil && re.MatchString(message) {
+		return Decision{Hold, "contains a term blocked by the channel"}
+	}
+	if m.maxLinks >= 0 {
+		if n := len(linkPattern.FindAllStringIndex(message, -1)); n > m.maxLinks {
+			return Decision{Hold, fmt.Sprintf("contains %d links", n)}
+		}
+	}
+	if m.scorer != nil {
+		ctx, cancel := context.WithTimeout(ctx, scoreTimeout)
+		defer cancel()
+		score, err := ai.ScoreComment(ctx, m.scorer, message)
+		if err != nil {
+			// Scoring is a second opinion; don't turn commenters away
+			// because the model is down.
+			log.Printf("moderation: scoring comment: %v", err)
+			return Decision{Outcome: Publish}
+		}
+		reason := "rated toxic"
+		if len(score.Reasons) > 0 {
+			reason += ": " + strings.Join(score.Reasons, ", ")
+		}
+		if score.Toxicity >= m.rejectScore {
+			return Decision{Reject, reason}
+		}
+		if score.Toxicity >= m.holdScore {
+			return Decision{Hold, reason}
+		}
+	}
+	return Decision{Outcome: Publish}
+}
@@ -0,0 +1,183 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/hi-wesley/mini-youtube/internal/ai"
+)
+
+func TestWordsPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		words   []string
+		message string
+		want    bool
+	}{
+		{"whole word", []string{"spam"}, "this is spam", true},
+		{"ignores case", []string{"Spam"}, "SPAM everywhere", true},
+		{"start of message", []string{"spam"}, "spam!", true},
+		{"inside a word", []string{"spam"}, "spammer", false},
+		{"end of a word", []string{"ass"}, "a classic pass", false},
+		{"between punctuation", []string{"spam"}, "(spam)", true},
+		{"phrase", []string{"buy now"}, "please buy now", true},
+		{"phrase with extra whitespace", []string{"buy now"}, "buy \t\n  now", true},
+		{"phrase entry with extra whitespace", []string{"  buy   now "}, "buy now", true},
+		{"phrase split by a word", []string{"buy now"}, "buy it now", false},
+		{"phrase inside words", []string{"buy now"}, "rebuy nowhere", false},
+		{"punctuation in the term", []string{"c++"}, "i love c++ a lot", true},
+		{"term ending in punctuation", []string{"wow!"}, "wow!!", true},
+		{"term ending in punctuation before a word", []string{"wow!"}, "wow!such", false},
+		{"term ending in punctuation at the end", []string{"wow!"}, "so wow!", true},
+		{"regex characters are literal", []string{"a.b"}, "axb", false},
+		{"any of several", []string{"foo", "bar"}, "just bar", true},
+		{"unicode", []string{"café"}, "at the CAFÉ today", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re := wordsPattern(tt.words)
+			if re == nil {
+				t.Fatalf("wordsPattern(%q) = nil", tt.words)
+			}
+			if got := re.MatchString(tt.message); got != tt.want {
+				t.Errorf("wordsPattern(%q) matching %q = %v, want %v", tt.words, tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordsPatternEmpty(t *testing.T) {
+	for _, words := range [][]string{nil, {}, {"", "  ", "\t"}} {
+		if re := wordsPattern(words); re != nil {
+			t.Errorf("wordsPattern(%q) = %v, want nil", words, re)
+		}
+	}
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	list := "# comments and blank lines are skipped\n\nbadword\n  bad phrase  \n/(?i)fr[e3]{2} money/\n/exact/\n"
+	if err := os.WriteFile(path, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blocked, err := loadBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{"a BADWORD here", true},
+		{"badwords", false},
+		{"a bad   phrase", true},
+		{"FR33 money", true},
+		{"Exact", false}, // regexes are case-sensitive unless they say otherwise
+		{"exactly", true},
+		{"# comments and blank lines are skipped", false},
+		{"nothing wrong", false},
+	}
+	for _, tt := range tests {
+		if got := matchesAny(blocked, tt.message); got != tt.want {
+			t.Errorf("blocklist matching %q = %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestLoadBlocklistErrors(t *testing.T) {
+	if _, err := loadBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing file: want an error")
+	}
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("ok\n/([a-z/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBlocklist(path); err == nil {
+		t.Error("invalid regex: want an error")
+	}
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLinkPattern(t *testing.T) {
+	tests := []struct {
+		message string
+		want    int
+	}{
+		{"no links here", 0},
+		{"see https://example.com", 1},
+		{"HTTP://A.COM and www.b.com", 2},
+		{"http://a.com https://b.com www.c.com", 3},
+		{"awww.cute", 0},
+		{"mailto:someone@example.com", 0},
+	}
+	for _, tt := range tests {
+		if got := len(linkPattern.FindAllStringIndex(tt.message, -1)); got != tt.want {
+			t.Errorf("links in %q = %d, want %d", tt.message, got, tt.want)
+		}
+	}
+}
+
+// scorer replies with a fixed toxicity, or fails.
+type scorer struct {
+	toxicity float64
+	err      error
+}
+
+func (s scorer) Generate(ctx context.Context, in *ai.Input, prompt string, schema *ai.Schema) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	return fmt.Sprintf(`{"toxicity": %g, "reasons": ["harassment"]}`, s.toxicity), nil
+}
+
+func (scorer) Model() string { return "test" }
+func (scorer) Close() error  { return nil }
+
+func TestCheck(t *testing.T) {
+	site := []*regexp.Regexp{wordsPattern([]string{"sitebanned"})}
+	tests := []struct {
+		name    string
+		m       *Moderator
+		message string
+		channel []string
+		want    Outcome
+		wantWhy string
+	}{
+		{"clean", &Moderator{maxLinks: 2}, "nice video", nil, Publish, ""},
+		{"default publishes everything", Default, "sitebanned http://a http://b http://c", nil, Publish, ""},
+		{"site blocklist rejects", &Moderator{blocked: site, maxLinks: -1}, "so SITEBANNED", nil, Reject, "contains a blocked word"},
+		{"channel terms hold", &Moderator{maxLinks: -1}, "that is spoiler stuff", []string{"spoiler"}, Hold, "contains a term blocked by the channel"},
+		{"site blocklist wins over channel terms", &Moderator{blocked: site, maxLinks: -1}, "sitebanned spoiler", []string{"spoiler"}, Reject, "contains a blocked word"},
+		{"links up to the limit", &Moderator{maxLinks: 2}, "http://a.com www.b.com", nil, Publish, ""},
+		{"links over the limit hold", &Moderator{maxLinks: 2}, "http://a.com www.b.com https://c.com", nil, Hold, "contains 3 links"},
+		{"no links allowed", &Moderator{maxLinks: 0}, "see www.a.com", nil, Hold, "contains 1 links"},
+		{"link limit off", &Moderator{maxLinks: -1}, "http://a http://b http://c http://d", nil, Publish, ""},
+		{"score below hold", &Moderator{maxLinks: -1, scorer: scorer{toxicity: 0.2}, holdScore: 0.6, rejectScore: 0.9}, "hm", nil, Publish, ""},
+		{"score at hold", &Moderator{maxLinks: -1, scorer: scorer{toxicity: 0.6}, holdScore: 0.6, rejectScore: 0.9}, "hm", nil, Hold, "rated toxic: harassment"},
+		{"score at reject", &Moderator{maxLinks: -1, scorer: scorer{toxicity: 0.9}, holdScore: 0.6, rejectScore: 0.9}, "hm", nil, Reject, "rated toxic: harassment"},
+		{"scorer down publishes", &Moderator{maxLinks: -1, scorer: scorer{err: errors.New("down")}, holdScore: 0.6, rejectScore: 0.9}, "hm", nil, Publish, ""},
+		{"malformed score publishes", &Moderator{maxLinks: -1, scorer: scorer{toxicity: 7}, holdScore: 0.6, rejectScore: 0.9}, "hm", nil, Publish, ""},
+		{"fake provider", &Moderator{maxLinks: -1, scorer: ai.Fake{}, holdScore: 0.6, rejectScore: 0.9}, "you are toxic", nil, Reject, `rated toxic: contains "toxic"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.m.Check(context.Background(), tt.message, tt.channel)
+			if got.Outcome != tt.want || got.Reason != tt.wantWhy {
+				t.Errorf("Check(%q) = %+v, want {%s %s}", tt.message, got, tt.want, tt.wantWhy)
+			}
+		})
+	}
+}
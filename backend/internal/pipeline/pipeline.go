@@ -0,0 +1,207 @@
+// This file turns the media and AI steps that run after an upload into jobs
+// on the background queue. Both cmd/server and cmd/worker call Register so
+// either can process them.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"github.com/hi-wesley/mini-youtube/internal/ai"
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/jobs"
+	"github.com/hi-wesley/mini-youtube/internal/media"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+// Job types handled by this package.
+const (
+	JobProbe     = "video.probe"
+	JobThumbnail = "video.thumbnail"
+	JobTranscode = "video.transcode"
+	JobPreview   = "video.preview"
+	JobSummary   = "video.summary"
+)
+
+// VideoPayload is the payload of every per-video job.
+type VideoPayload struct {
+	VideoID string `json:"video_id"`
+}
+
+// Register installs the pipeline's job handlers, including the periodic purge
+// of deleted videos and publishing of scheduled ones.
+func Register() {
+	jobs.Handle(JobProbe, probe)
+	jobs.Handle(JobThumbnail, thumbnail)
+	jobs.Handle(JobTranscode, transcode)
+	jobs.Handle(JobPreview, preview)
+	jobs.Handle(JobSummary, summary)
+	registerPurge()
+	registerPublish()
+}
+
+// EnqueueVideo starts processing a freshly uploaded video. Pass the
+// transaction that created the video so the work commits with it.
+func EnqueueVideo(tx *gorm.DB, videoID string) error {
+	if err := createSteps(tx, videoID); err != nil {
+		return fmt.Errorf("create steps: %w", err)
+	}
+	return enqueue(tx, JobProbe, videoID)
+}
+
+func enqueue(tx *gorm.DB, jobType, videoID string) error {
+	if err := jobs.EnqueueTx(tx, jobType, VideoPayload{VideoID: videoID}, jobs.UniqueKey(jobType+":"+videoID)); err != nil {
+		return fmt.Errorf("enqueue %s: %w", jobType, err)
+	}
+	return nil
+}
+
+func loadVideo(ctx context.Context, id string) (*models.Video, error) {
+	var v models.Video
+	err := db.Conn.WithContext(ctx).First(&v, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, jobs.Permanent(fmt.Errorf("video %s not found", id))
+	}
+	return &v, err
+}
+
+// probe inspects the upload and, if it really is a video, fans out to the
+// remaining steps.
+func probe(ctx context.Context, p VideoPayload) error {
+	v, err := loadVideo(ctx, p.VideoID)
+	if err != nil {
+		return err
+	}
+	if v.Status == models.VideoUploaded {
+		if _, err := Transition(db.Conn.WithContext(ctx), v.ID, models.VideoUploaded, models.VideoProbing, ""); err != nil {
+			return err
+		}
+	}
+
+	return runStep(ctx, v.ID, models.StepProbe, func() error {
+		res, err := media.ProbeObject(ctx, v.ObjectName)
+		if err != nil {
+			return err
+		}
+		if res.VideoCodec == "" {
+			return jobs.Permanent(errors.New("no video stream found"))
+		}
+
+		return db.Conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(v).Updates(map[string]interface{}{
+				"duration": res.Duration,
+				"width":    res.Width,
+				"height":   res.Height,
+			}).Error; err != nil {
+				return err
+			}
+			moved, err := Transition(tx, v.ID, models.VideoProbing, models.VideoProcessing, "")
+			if err != nil || !moved {
+				return err
+			}
+			for _, t := range []string{JobThumbnail, JobTranscode, JobPreview, JobSummary} {
+				if err := enqueue(tx, t, v.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func thumbnail(ctx context.Context, p VideoPayload) error {
+	v, err := loadVideo(ctx, p.VideoID)
+	if err != nil {
+		return err
+	}
+	return runStep(ctx, v.ID, models.StepThumbnail, func() error {
+		candidates, err := media.GenerateThumbnailCandidates(ctx, v.ObjectName)
+		if err != nil {
+			return err
+		}
+		return saveThumbnails(ctx, v.ID, candidates)
+	})
+}
+
+// saveThumbnails replaces the video's frame candidates and selects the best
+// scoring one, unless the owner already picked a thumbnail of their own.
+func saveThumbnails(ctx context.Context, videoID string, candidates []models.Thumbnail) error {
+	if len(candidates) == 0 {
+		return fmt.Errorf("no thumbnail candidates for video %s", videoID)
+	}
+	return db.Conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("video_id = ? AND source = ?", videoID, models.ThumbnailFrame).Delete(&models.Thumbnail{}).Error
+		if err != nil {
+			return err
+		}
+		best := 0
+		for i := range candidates {
+			candidates[i].VideoID = videoID
+			if candidates[i].Score > candidates[best].Score {
+				best = i
+			}
+		}
+		if err := tx.Create(&candidates).Error; err != nil {
+			return err
+		}
+		var custom int64
+		if err := tx.Model(&models.Thumbnail{}).Where("video_id = ? AND selected", videoID).Count(&custom).Error; err != nil {
+			return err
+		}
+		if custom > 0 {
+			return nil
+		}
+		return media.SelectThumbnail(tx, &candidates[best])
+	})
+}
+
+func transcode(ctx context.Context, p VideoPayload) error {
+	v, err := loadVideo(ctx, p.VideoID)
+	if err != nil {
+		return err
+	}
+	return runStep(ctx, v.ID, models.StepTranscode, func() error {
+		return media.TranscodeAndStoreHLS(ctx, v.ID, v.ObjectName)
+	})
+}
+
+func preview(ctx context.Context, p VideoPayload) error {
+	v, err := loadVideo(ctx, p.VideoID)
+	if err != nil {
+		return err
+	}
+	return runStep(ctx, v.ID, models.StepPreview, func() error {
+		previews, err := media.GeneratePreviews(ctx, v.ObjectName)
+		if err != nil {
+			return err
+		}
+		return db.Conn.WithContext(ctx).Model(v).Updates(map[string]interface{}{
+			"preview_url":      previews.MP4URL,
+			"preview_webp_url": previews.WebPURL,
+			"storyboard_url":   previews.StoryboardURL,
+		}).Error
+	})
+}
+
+func summary(ctx context.Context, p VideoPayload) error {
+	v, err := loadVideo(ctx, p.VideoID)
+	if err != nil {
+		return err
+	}
+	return runStep(ctx, v.ID, models.StepSummary, func() error {
+		if ai.Default == nil {
+			return errSkipped
+		}
+		err := ai.AnalyzeAndStore(ctx, ai.Default, v)
+		if errors.Is(err, ai.ErrUnsupported) {
+			// e.g. Vertex AI, which only reads from GCS, with local storage
+			log.Printf("pipeline: skipping summary for video %s: %v", v.ID, err)
+			return errSkipped
+		}
+		return err
+	})
+}
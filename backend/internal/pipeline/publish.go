@@ -0,0 +1,37 @@
+// This file publishes scheduled videos. Queries already treat a scheduled
+// video whose time has passed as public; this job makes that permanent so
+// the video is an ordinary public one from then on.
+package pipeline
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/jobs"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+// JobPublish makes scheduled videos public once their publish time passes.
+const JobPublish = "video.publish"
+
+func registerPublish() {
+	jobs.Handle(JobPublish, func(ctx context.Context, _ struct{}) error {
+		return publishScheduled(ctx)
+	})
+	jobs.Every(time.Minute, JobPublish)
+}
+
+func publishScheduled(ctx context.Context) error {
+	res := db.Conn.WithContext(ctx).Model(&models.Video{}).
+		Where("visibility = ? AND publish_at <= ?", models.VisibilityScheduled, time.Now()).
+		Update("visibility", models.VisibilityPublic)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("pipeline: published %d scheduled videos", res.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// This file hard-deletes videos whose owners deleted them more than the
+// restore window ago. Each video is first claimed by moving it to purging,
+// which RestoreVideo refuses. The row goes last, once the original, the
+// thumbnail and everything under the derived prefix are gone from the blob
+// store, and the database cascades the delete to comments, likes and the
+// other child rows.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/config"
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/jobs"
+	"github.com/hi-wesley/mini-youtube/internal/media"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+// JobPurge removes soft-deleted videos past their restore window.
+const JobPurge = "video.purge"
+
+func registerPurge() {
+	jobs.Handle(JobPurge, func(ctx context.Context, _ struct{}) error {
+		return purgeDeleted(ctx)
+	})
+	jobs.Every(time.Hour, JobPurge)
+}
+
+func purgeDeleted(ctx context.Context) error {
+	cutoff := time.Now().Add(-config.Load().VideoRestoreWindow)
+	var videos []models.Video
+	err := db.Conn.WithContext(ctx).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Order("deleted_at ASC").Limit(100).Find(&videos).Error
+	if err != nil {
+		return err
+	}
+
+	var purged, failed int
+	for i := range videos {
+		ok, err := Purge(ctx, &videos[i], cutoff)
+		if err != nil {
+			log.Printf("pipeline: purging video %s failed: %v", videos[i].ID, err)
+			failed++
+		} else if ok {
+			purged++
+		}
+	}
+	if len(videos) > 0 {
+		log.Printf("pipeline: purged %d deleted videos (%d failed)", purged, failed)
+	}
+	return nil
+}
+
+// Purge deletes a video's files and then the video itself, provided it was
+// deleted before cutoff. It reports false without touching anything if the
+// video no longer qualifies, for example because it was restored after it was
+// loaded. Objects that are already gone are skipped, so a failed purge can
+// simply be run again.
+func Purge(ctx context.Context, v *models.Video, cutoff time.Time) (bool, error) {
+	res := db.Conn.WithContext(ctx).Model(&models.Video{}).
+		Where("id = ? AND deleted_at IS NOT NULL AND deleted_at < ?", v.ID, cutoff).
+		Update("status", models.VideoPurging)
+	if res.Error != nil {
+		return false, fmt.Errorf("claim video: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+
+	names := []string{v.ObjectName}
+	if thumb, ok := storage.ObjectName(storage.Store, v.ThumbnailURL); ok {
+		names = append(names, thumb)
+	}
+	derived, err := storage.Store.List(ctx, media.DerivedPrefix(v.ObjectName))
+	if err != nil {
+		return false, fmt.Errorf("list derived files: %w", err)
+	}
+	for _, a := range derived {
+		names = append(names, a.Name)
+	}
+	for _, name := range names {
+		if err := storage.Store.Delete(ctx, name); err != nil && !errors.Is(err, storage.ErrNotExist) {
+			return false, fmt.Errorf("delete %s: %w", name, err)
+		}
+	}
+	res = db.Conn.WithContext(ctx).Delete(&models.Video{},
+		"id = ? AND status = ? AND deleted_at IS NOT NULL AND deleted_at < ?", v.ID, models.VideoPurging, cutoff)
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,141 @@
+// This file implements the video status state machine. A video is created as
+// "uploaded", moves to "probing" while ffprobe inspects it, to "processing"
+// while the thumbnail/transcode/summary steps run, and finally settles on
+// "ready" or "failed". Each step keeps its own status and failure reason.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/jobs"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+)
+
+// allSteps are created for every new video, in pipeline order.
+var allSteps = []string{models.StepProbe, models.StepThumbnail, models.StepTranscode, models.StepPreview, models.StepSummary}
+
+// requiredSteps fail the whole video when they fail. A missing summary or
+// preview is recorded on its step but does not stop the video from being
+// published.
+var requiredSteps = map[string]bool{
+	models.StepProbe:     true,
+	models.StepThumbnail: true,
+	models.StepTranscode: true,
+}
+
+// transitions lists the statuses a video may move to from each status.
+var transitions = map[string][]string{
+	models.VideoUploaded:   {models.VideoProbing, models.VideoFailed},
+	models.VideoProbing:    {models.VideoProcessing, models.VideoFailed},
+	models.VideoProcessing: {models.VideoReady, models.VideoFailed},
+}
+
+// errSkipped is returned by a step that does not apply to this video.
+var errSkipped = errors.New("step skipped")
+
+// Transition moves a video from one status to another. The update only
+// applies if the video is still in status from, so concurrent workers can't
+// move it twice. It reports whether the video changed.
+func Transition(tx *gorm.DB, videoID, from, to, reason string) (bool, error) {
+	allowed := false
+	for _, s := range transitions[from] {
+		allowed = allowed || s == to
+	}
+	if !allowed {
+		return false, fmt.Errorf("invalid video status transition %s -> %s", from, to)
+	}
+	res := tx.Model(&models.Video{}).
+		Where("id = ? AND status = ?", videoID, from).
+		Updates(map[string]interface{}{"status": to, "failure_reason": reason})
+	return res.RowsAffected > 0, res.Error
+}
+
+// createSteps records every step of a new video as pending.
+func createSteps(tx *gorm.DB, videoID string) error {
+	steps := make([]models.VideoStep, len(allSteps))
+	for i, name := range allSteps {
+		steps[i] = models.VideoStep{VideoID: videoID, Name: name, Status: models.StepPending}
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&steps).Error
+}
+
+func saveStep(ctx context.Context, step models.VideoStep) {
+	err := db.Conn.WithContext(context.WithoutCancel(ctx)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "video_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "error", "attempts", "updated_at"}),
+	}).Create(&step).Error
+	if err != nil {
+		log.Printf("pipeline: saving step %s of video %s: %v", step.Name, step.VideoID, err)
+	}
+}
+
+// runStep wraps one processing step with status bookkeeping. Errors are
+// returned to the job queue for retrying; once the queue gives up the step is
+// marked failed and the video is settled.
+func runStep(ctx context.Context, videoID, name string, fn func() error) error {
+	step := models.VideoStep{VideoID: videoID, Name: name}
+	db.Conn.WithContext(ctx).Select("attempts").Where("video_id = ? AND name = ?", videoID, name).Take(&step)
+	step.Attempts++
+	step.Status = models.StepRunning
+	step.Error = ""
+	saveStep(ctx, step)
+
+	err := fn()
+	switch {
+	case err == nil:
+		step.Status = models.StepSucceeded
+	case errors.Is(err, errSkipped):
+		step.Status = models.StepSkipped
+		err = nil
+	case jobs.IsPermanent(err) || jobs.LastAttempt(ctx):
+		step.Status = models.StepFailed
+		step.Error = err.Error()
+	default:
+		// The queue will try again; keep the reason visible meanwhile.
+		step.Status = models.StepPending
+		step.Error = err.Error()
+		saveStep(ctx, step)
+		return err
+	}
+	saveStep(ctx, step)
+	settle(context.WithoutCancel(ctx), videoID)
+	return err
+}
+
+// settle decides whether a video is finished now that one of its steps is.
+func settle(ctx context.Context, videoID string) {
+	var steps []models.VideoStep
+	if err := db.Conn.WithContext(ctx).Where("video_id = ?", videoID).Find(&steps).Error; err != nil {
+		log.Printf("pipeline: loading steps of video %s: %v", videoID, err)
+		return
+	}
+
+	done := true
+	for _, s := range steps {
+		if s.Status == models.StepFailed && requiredSteps[s.Name] {
+			res := db.Conn.WithContext(ctx).Model(&models.Video{}).
+				Where("id = ? AND status IN ?", videoID, []string{models.VideoUploaded, models.VideoProbing, models.VideoProcessing}).
+				Updates(map[string]interface{}{"status": models.VideoFailed, "failure_reason": s.Name + ": " + s.Error})
+			if res.Error != nil {
+				log.Printf("pipeline: failing video %s: %v", videoID, res.Error)
+			}
+			return
+		}
+		if s.Status == models.StepPending || s.Status == models.StepRunning {
+			done = false
+		}
+	}
+	if !done {
+		return
+	}
+	if _, err := Transition(db.Conn.WithContext(ctx), videoID, models.VideoProcessing, models.VideoReady, ""); err != nil {
+		log.Printf("pipeline: marking video %s ready: %v", videoID, err)
+	}
+}
@@ -0,0 +1,68 @@
+// This file defines the hub that carries live updates, such as new comments,
+// to the websockets watching them. Publishers and subscribers only talk to
+// the Hub interface: a single instance can fan out in memory, while several
+// instances behind a load balancer share Redis pub/sub so a message published
+// on one reaches subscribers on all of them.
+package realtime
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Hub delivers every message published on a topic to every current
+// subscriber of that topic.
+type Hub interface {
+	// Subscribe starts receiving the topic's messages on the returned
+	// subscription until it is closed.
+	Subscribe(topic string) (*Subscription, error)
+	// Publish sends msg to the topic's subscribers. It does not wait for
+	// them to receive it.
+	Publish(ctx context.Context, topic string, msg []byte) error
+	Close() error
+}
+
+// subscriptionBuffer is how many messages a subscriber can fall behind by
+// before it is evicted.
+const subscriptionBuffer = 64
+
+// Subscription is one subscriber's view of a topic.
+type Subscription struct {
+	// C receives the topic's messages. It is closed by Close, or by the
+	// hub when the subscriber falls too far behind.
+	C <-chan []byte
+
+	close   func()
+	evicted atomic.Bool
+}
+
+// Evicted reports whether C was closed because the subscriber stopped
+// keeping up, rather than by Close.
+func (s *Subscription) Evicted() bool {
+	return s.evicted.Load()
+}
+
+// Close stops the subscription and closes C. It is safe to call more than
+// once.
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// Default is the process-wide hub, set up by Init.
+var Default Hub
+
+// Init sets up Default and DefaultPresence on Redis when rdb is set, and in
+// memory otherwise.
+func Init(rdb *redis.Client) {
+	if rdb == nil {
+		log.Printf("realtime: no Redis, live updates only reach clients on this instance")
+		Default = NewMemoryHub()
+		DefaultPresence = NewMemoryPresence()
+		return
+	}
+	Default = NewRedisHub(rdb)
+	DefaultPresence = NewRedisPresence(rdb)
+}
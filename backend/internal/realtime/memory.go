@@ -0,0 +1,174 @@
+// This file is the in-memory hub. Topics exist only while they have
+// subscribers; the last one to leave removes the topic, so videos nobody is
+// watching cost nothing.
+package realtime
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// MemoryHub fans messages out within this process.
+type MemoryHub struct {
+	mu     sync.Mutex
+	topics map[string]*topic
+	// leaving holds topics whose onIdle is still running; they can't be
+	// subscribed to again until it is done.
+	leaving map[string]chan struct{}
+	// onIdle and onActive, when set, are called without mu held as a topic
+	// loses its last or gains its first subscriber. Calls for one topic
+	// never overlap. A topic's subscribers wait for its onActive.
+	onActive func(topic string) error
+	onIdle   func(topic string)
+}
+
+type topic struct {
+	subs map[chan []byte]*Subscription
+	// active is set once onActive has succeeded; until then the topic has
+	// no subscribers and ready is open.
+	active bool
+	ready  chan struct{}
+	err    error
+}
+
+// NewMemoryHub returns an empty in-memory hub.
+func NewMemoryHub() *MemoryHub {
+	return &MemoryHub{topics: map[string]*topic{}, leaving: map[string]chan struct{}{}}
+}
+
+func (h *MemoryHub) Subscribe(name string) (*Subscription, error) {
+	h.mu.Lock()
+	for {
+		if done, ok := h.leaving[name]; ok {
+			h.mu.Unlock()
+			<-done
+			h.mu.Lock()
+			continue
+		}
+		t := h.topics[name]
+		if t == nil {
+			if err := h.activate(name); err != nil {
+				h.mu.Unlock()
+				return nil, err
+			}
+			continue
+		}
+		if !t.active {
+			h.mu.Unlock()
+			<-t.ready
+			if t.err != nil {
+				return nil, t.err
+			}
+			h.mu.Lock()
+			continue
+		}
+
+		ch := make(chan []byte, subscriptionBuffer)
+		var once sync.Once
+		sub := &Subscription{C: ch}
+		sub.close = func() {
+			once.Do(func() { h.unsubscribe(name, ch) })
+		}
+		t.subs[ch] = sub
+		h.mu.Unlock()
+		return sub, nil
+	}
+}
+
+// activate adds the topic and runs onActive for it. It is called with mu
+// held and returns with it held, but releases it meanwhile; the topic is
+// removed again if onActive fails.
+func (h *MemoryHub) activate(name string) error {
+	t := &topic{subs: map[chan []byte]*Subscription{}, ready: make(chan struct{})}
+	h.topics[name] = t
+	h.mu.Unlock()
+	var err error
+	if h.onActive != nil {
+		err = h.onActive(name)
+	}
+	h.mu.Lock()
+	t.err = err
+	t.active = err == nil
+	if err != nil && h.topics[name] == t {
+		delete(h.topics, name)
+	}
+	close(t.ready)
+	return err
+}
+
+func (h *MemoryHub) unsubscribe(topic string, ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t := h.topics[topic]
+	if t == nil {
+		return
+	}
+	if _, ok := t.subs[ch]; !ok {
+		return // already closed by Close or evicted
+	}
+	h.remove(topic, ch)
+}
+
+// remove drops ch from the topic and closes it. Sends happen with mu held,
+// so callers must hold it too; nothing can then be sending on ch.
+func (h *MemoryHub) remove(name string, ch chan []byte) {
+	t := h.topics[name]
+	delete(t.subs, ch)
+	close(ch)
+	if len(t.subs) > 0 {
+		return
+	}
+	delete(h.topics, name)
+	if h.onIdle == nil {
+		return
+	}
+	done := make(chan struct{})
+	h.leaving[name] = done
+	go func() {
+		h.onIdle(name)
+		h.mu.Lock()
+		delete(h.leaving, name)
+		h.mu.Unlock()
+		close(done)
+	}()
+}
+
+func (h *MemoryHub) Publish(_ context.Context, topic string, msg []byte) error {
+	h.deliver(topic, msg)
+	return nil
+}
+
+// deliver hands msg to the topic's subscribers without blocking. One whose
+// buffer is full has stopped keeping up, so it is evicted rather than left
+// to miss messages silently or hold up the rest.
+func (h *MemoryHub) deliver(topic string, msg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t := h.topics[topic]
+	if t == nil {
+		return
+	}
+	for ch, sub := range t.subs {
+		select {
+		case ch <- msg:
+		default:
+			log.Printf("realtime: evicting slow subscriber of %s", topic)
+			sub.evicted.Store(true)
+			h.remove(topic, ch)
+		}
+	}
+}
+
+// Close ends every subscription.
+func (h *MemoryHub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for name, t := range h.topics {
+		for ch := range t.subs {
+			close(ch)
+		}
+		delete(h.topics, name)
+	}
+	return nil
+}
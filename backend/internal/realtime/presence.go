@@ -0,0 +1,148 @@
+// This file tracks who is watching a topic, for "N watching now". Each open
+// connection is a member of its topic until it leaves or goes PresenceTTL
+// without a Refresh, so connections held by an instance that died stop
+// counting on their own. With Redis the members are shared by every
+// instance; without it each instance only counts its own.
+package realtime
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PresenceTTL is how long a member counts after its last Join or Refresh.
+const PresenceTTL = 2 * time.Minute
+
+// Presence counts the live connections on each topic.
+type Presence interface {
+	// Join adds conn to the topic and returns how many are watching it.
+	Join(ctx context.Context, topic, conn string) (int64, error)
+	// Refresh keeps conn counted for another PresenceTTL.
+	Refresh(ctx context.Context, topic, conn string) error
+	// Leave removes conn from the topic and returns how many are left.
+	Leave(ctx context.Context, topic, conn string) (int64, error)
+}
+
+// DefaultPresence is the process-wide presence store, set up by Init.
+var DefaultPresence Presence
+
+// MemoryPresence counts the connections of this process.
+type MemoryPresence struct {
+	mu sync.Mutex
+	// topics maps each topic to its members' expiry times.
+	topics map[string]map[string]time.Time
+}
+
+// NewMemoryPresence returns an empty in-memory presence store.
+func NewMemoryPresence() *MemoryPresence {
+	return &MemoryPresence{topics: map[string]map[string]time.Time{}}
+}
+
+func (p *MemoryPresence) Join(_ context.Context, topic, conn string) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	members := p.topics[topic]
+	if members == nil {
+		members = map[string]time.Time{}
+		p.topics[topic] = members
+	}
+	members[conn] = time.Now().Add(PresenceTTL)
+	return p.count(topic), nil
+}
+
+func (p *MemoryPresence) Refresh(_ context.Context, topic, conn string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.topics[topic][conn]; ok {
+		p.topics[topic][conn] = time.Now().Add(PresenceTTL)
+	}
+	return nil
+}
+
+func (p *MemoryPresence) Leave(_ context.Context, topic, conn string) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.topics[topic], conn)
+	return p.count(topic), nil
+}
+
+// count drops the topic's expired members and counts the rest. p.mu must be
+// held.
+func (p *MemoryPresence) count(topic string) int64 {
+	now := time.Now()
+	members := p.topics[topic]
+	for conn, expires := range members {
+		if now.After(expires) {
+			delete(members, conn)
+		}
+	}
+	if len(members) == 0 {
+		delete(p.topics, topic)
+	}
+	return int64(len(members))
+}
+
+// presencePrefix namespaces our Redis presence keys.
+const presencePrefix = "presence:"
+
+// RedisPresence keeps each topic's members in a sorted set scored by their
+// expiry time, shared by every instance.
+type RedisPresence struct {
+	rdb *redis.Client
+}
+
+// NewRedisPresence stores presence in rdb.
+func NewRedisPresence(rdb *redis.Client) *RedisPresence {
+	return &RedisPresence{rdb: rdb}
+}
+
+func (p *RedisPresence) Join(ctx context.Context, topic, conn string) (int64, error) {
+	return p.update(ctx, topic, func(pipe redis.Pipeliner, key string) {
+		pipe.ZAdd(ctx, key, redis.Z{Score: expiry(), Member: conn})
+	})
+}
+
+func (p *RedisPresence) Refresh(ctx context.Context, topic, conn string) error {
+	key := presencePrefix + topic
+	_, err := p.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		// XX: a member that already expired and was pruned stays gone.
+		pipe.ZAddXX(ctx, key, redis.Z{Score: expiry(), Member: conn})
+		pipe.Expire(ctx, key, PresenceTTL)
+		return nil
+	})
+	return err
+}
+
+func (p *RedisPresence) Leave(ctx context.Context, topic, conn string) (int64, error) {
+	return p.update(ctx, topic, func(pipe redis.Pipeliner, key string) {
+		pipe.ZRem(ctx, key, conn)
+	})
+}
+
+// update applies change to the topic's set, prunes expired members and
+// counts the rest in one transaction. The key itself expires with its last
+// member, so topics nobody watches leave nothing behind.
+func (p *RedisPresence) update(ctx context.Context, topic string, change func(redis.Pipeliner, string)) (int64, error) {
+	key := presencePrefix + topic
+	var card *redis.IntCmd
+	_, err := p.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		change(pipe, key)
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+		card = pipe.ZCard(ctx, key)
+		pipe.Expire(ctx, key, PresenceTTL)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return card.Val(), nil
+}
+
+// expiry is the score of a member joining or refreshing now.
+func expiry() float64 {
+	return float64(time.Now().Add(PresenceTTL).UnixMilli())
+}
@@ -0,0 +1,81 @@
+// This file is the Redis hub. Every instance publishes to Redis and keeps a
+// single pub/sub connection, subscribed to the channels of the topics its own
+// clients are watching. Messages arriving on it are fanned out locally by a
+// MemoryHub, whose first and last subscribers to a topic drive the Redis
+// SUBSCRIBE and UNSUBSCRIBE.
+package realtime
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// channelPrefix namespaces our Redis channels.
+const channelPrefix = "hub:"
+
+// subscribeTimeout bounds a SUBSCRIBE or UNSUBSCRIBE, which the first
+// subscriber to a topic waits for.
+const subscribeTimeout = 5 * time.Second
+
+// RedisHub fans messages out across every instance sharing a Redis.
+type RedisHub struct {
+	rdb   *redis.Client
+	ps    *redis.PubSub
+	local *MemoryHub
+}
+
+// NewRedisHub starts listening on rdb.
+func NewRedisHub(rdb *redis.Client) *RedisHub {
+	h := &RedisHub{rdb: rdb, ps: rdb.Subscribe(context.Background()), local: NewMemoryHub()}
+	h.local.onActive = func(topic string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+		defer cancel()
+		err := h.ps.Subscribe(ctx, channelPrefix+topic)
+		if err != nil {
+			// go-redis remembers the channel even when the command fails,
+			// and would subscribe to it again on reconnect.
+			h.unsubscribe(topic)
+		}
+		return err
+	}
+	h.local.onIdle = h.unsubscribe
+	go h.receive()
+	return h
+}
+
+func (h *RedisHub) unsubscribe(topic string) {
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+	if err := h.ps.Unsubscribe(ctx, channelPrefix+topic); err != nil {
+		log.Printf("realtime: unsubscribing from %s: %v", topic, err)
+	}
+}
+
+// receive hands messages from Redis to local subscribers. The channel is
+// closed, ending the loop, when the pub/sub connection is closed. go-redis
+// reconnects and resubscribes on its own after network errors.
+func (h *RedisHub) receive() {
+	for msg := range h.ps.Channel() {
+		h.local.deliver(strings.TrimPrefix(msg.Channel, channelPrefix), []byte(msg.Payload))
+	}
+}
+
+func (h *RedisHub) Subscribe(topic string) (*Subscription, error) {
+	return h.local.Subscribe(topic)
+}
+
+// Publish goes through Redis even for subscribers on this instance, so
+// every subscriber sees messages in the order Redis does.
+func (h *RedisHub) Publish(ctx context.Context, topic string, msg []byte) error {
+	return h.rdb.Publish(ctx, channelPrefix+topic, msg).Err()
+}
+
+func (h *RedisHub) Close() error {
+	err := h.ps.Close()
+	h.local.Close()
+	return err
+}
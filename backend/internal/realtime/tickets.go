@@ -0,0 +1,89 @@
+// This file issues and checks websocket connection tickets. Browsers can't
+// set an Authorization header on a websocket, so rather than putting the
+// Firebase ID token in the URL (and every access log), clients trade it for
+// a ticket over REST and send that in the Sec-WebSocket-Protocol header.
+// A ticket is signed by the server, names one video and lasts a minute; it
+// may name no user, in which case the socket is anonymous.
+package realtime
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// TicketTTL is how long a ticket can be used to open a socket.
+const TicketTTL = time.Minute
+
+var ticketKey []byte
+
+// InitSocketTickets sets the key tickets are signed with. When key is empty
+// a random one is generated, which is only right for a single instance:
+// tickets issued by one instance are then refused by the others.
+func InitSocketTickets(key string) error {
+	ticketKey = []byte(key)
+	if len(ticketKey) == 0 {
+		log.Println("SOCKET_SIGNING_KEY not set, generating a temporary signing key")
+		ticketKey = make([]byte, 32)
+		if _, err := rand.Read(ticketKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ticketClaims struct {
+	UID     string `json:"u,omitempty"`
+	VideoID string `json:"v"`
+	Expires int64  `json:"e"`
+}
+
+// ErrInvalidTicket is returned for tickets that are malformed, forged,
+// expired or for another video.
+var ErrInvalidTicket = errors.New("invalid ticket")
+
+func signTicket(payload string) string {
+	mac := hmac.New(sha256.New, ticketKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueTicket returns a ticket for uid, which may be empty, to follow the
+// video, and when it expires. Tickets only use characters allowed in a
+// websocket subprotocol.
+func IssueTicket(uid, videoID string) (string, time.Time, error) {
+	exp := time.Now().Add(TicketTTL)
+	raw, err := json.Marshal(ticketClaims{UID: uid, VideoID: videoID, Expires: exp.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + signTicket(payload), exp, nil
+}
+
+// VerifyTicket checks a ticket for the video and returns the user it was
+// issued to, empty for an anonymous one.
+func VerifyTicket(ticket, videoID string) (string, error) {
+	payload, sig, ok := strings.Cut(ticket, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signTicket(payload))) {
+		return "", ErrInvalidTicket
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidTicket
+	}
+	var claims ticketClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return "", ErrInvalidTicket
+	}
+	if claims.VideoID != videoID || time.Now().Unix() > claims.Expires {
+		return "", ErrInvalidTicket
+	}
+	return claims.UID, nil
+}
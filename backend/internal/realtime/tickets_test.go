@@ -0,0 +1,118 @@
+package realtime
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// craftTicket signs claims the way IssueTicket does, so tests can choose the
+// expiry.
+func craftTicket(t *testing.T, claims ticketClaims) string {
+	t.Helper()
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + signTicket(payload)
+}
+
+func flipFirst(s string) string {
+	if s[0] == 'A' {
+		return "B" + s[1:]
+	}
+	return "A" + s[1:]
+}
+
+func TestVerifyTicket(t *testing.T) {
+	if err := InitSocketTickets("test-key"); err != nil {
+		t.Fatal(err)
+	}
+	issue := func(uid, videoID string) string {
+		ticket, _, err := IssueTicket(uid, videoID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ticket
+	}
+	valid := issue("user-1", "video-1")
+	payload, _, _ := strings.Cut(valid, ".")
+
+	// A ticket for another user, signed with another key.
+	if err := InitSocketTickets("other-key"); err != nil {
+		t.Fatal(err)
+	}
+	otherKey := issue("user-2", "video-1")
+	if err := InitSocketTickets("test-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The claims of the valid ticket, rewritten to name another user but
+	// keeping the original signature.
+	forgedClaims, _ := json.Marshal(ticketClaims{UID: "user-2", VideoID: "video-1", Expires: time.Now().Add(TicketTTL).Unix()})
+	_, sig, _ := strings.Cut(valid, ".")
+	forged := base64.RawURLEncoding.EncodeToString(forgedClaims) + "." + sig
+
+	tests := []struct {
+		name    string
+		ticket  string
+		videoID string
+		wantUID string
+		wantErr bool
+	}{
+		{"valid", valid, "video-1", "user-1", false},
+		{"anonymous", issue("", "video-1"), "video-1", "", false},
+		{"wrong video", valid, "video-2", "", true},
+		{"anonymous for wrong video", issue("", "video-1"), "video-2", "", true},
+		{"expired", craftTicket(t, ticketClaims{UID: "user-1", VideoID: "video-1", Expires: time.Now().Add(-time.Second).Unix()}), "video-1", "", true},
+		{"forged claims", forged, "video-1", "", true},
+		{"signed with another key", otherKey, "video-1", "", true},
+		{"tampered signature", payload + "." + flipFirst(sig), "video-1", "", true},
+		{"no signature", payload, "video-1", "", true},
+		{"empty signature", payload + ".", "video-1", "", true},
+		{"not base64", "!!!." + signTicket("!!!"), "video-1", "", true},
+		{"not JSON", "bm9wZQ." + signTicket("bm9wZQ"), "video-1", "", true},
+		{"empty", "", "video-1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, err := VerifyTicket(tt.ticket, tt.videoID)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTicket) {
+					t.Fatalf("VerifyTicket() error = %v, want ErrInvalidTicket", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyTicket() error = %v", err)
+			}
+			if uid != tt.wantUID {
+				t.Errorf("VerifyTicket() uid = %q, want %q", uid, tt.wantUID)
+			}
+		})
+	}
+}
+
+func TestIssueTicketIsSubprotocolSafe(t *testing.T) {
+	if err := InitSocketTickets("test-key"); err != nil {
+		t.Fatal(err)
+	}
+	ticket, expires, err := IssueTicket("user/with+odd=chars", "video-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expires); d <= 0 || d > TicketTTL {
+		t.Errorf("expires in %s, want within %s", d, TicketTTL)
+	}
+	// Subprotocols are HTTP tokens; base64url and the dot all qualify.
+	for _, r := range ticket {
+		ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.", r)
+		if !ok {
+			t.Fatalf("ticket %q contains %q", ticket, r)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// This file implements BlobStore on top of a Google Cloud Storage bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// GCSStore keeps objects in a single GCS bucket.
+type GCSStore struct {
+	client *gcs.Client
+	bucket string
+}
+
+func NewGCSStore(ctx context.Context, bucket string) (*GCSStore, error) {
+	if bucket == "" {
+		return nil, errors.New("GCS bucket not configured")
+	}
+	client, err := gcs.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	return &GCSStore{client: client, bucket: bucket}, nil
+}
+
+// URI returns the gs:// form of an object name, which Vertex AI reads directly.
+func (s *GCSStore) URI(name string) string {
+	return "gs://" + s.bucket + "/" + name
+}
+
+func (s *GCSStore) SignedPutURL(ctx context.Context, name, contentType string, expires time.Duration) (string, error) {
+	return s.client.Bucket(s.bucket).SignedURL(name, &gcs.SignedURLOptions{
+		Method:      "PUT",
+		Expires:     time.Now().Add(expires),
+		ContentType: contentType,
+	})
+}
+
+func (s *GCSStore) SignedGetURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	return s.client.Bucket(s.bucket).SignedURL(name, &gcs.SignedURLOptions{
+		Method:  "GET",
+		Expires: time.Now().Add(expires),
+	})
+}
+
+func (s *GCSStore) PublicURL(name string) string {
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", s.bucket, name)
+}
+
+func (s *GCSStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, err := s.client.Bucket(s.bucket).Object(name).NewReader(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, ErrNotExist
+	}
+	return r, err
+}
+
+// Create writes through a context of its own, so Abort can cancel the upload:
+// GCS only creates the object once the writer is closed without error.
+func (s *GCSStore) Create(ctx context.Context, name, contentType string) (Writer, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := s.client.Bucket(s.bucket).Object(name).NewWriter(ctx)
+	w.ContentType = contentType
+	return &gcsWriter{Writer: w, cancel: cancel}, nil
+}
+
+type gcsWriter struct {
+	*gcs.Writer
+	cancel context.CancelFunc
+}
+
+func (w *gcsWriter) Close() error {
+	defer w.cancel()
+	return w.Writer.Close()
+}
+
+func (w *gcsWriter) Abort() {
+	w.cancel()
+	w.Writer.Close()
+}
+
+func (s *GCSStore) Delete(ctx context.Context, name string) error {
+	err := s.client.Bucket(s.bucket).Object(name).Delete(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
+
+func (s *GCSStore) List(ctx context.Context, prefix string) ([]ObjectAttrs, error) {
+	var out []ObjectAttrs
+	it := s.client.Bucket(s.bucket).Objects(ctx, &gcs.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating objects: %w", err)
+		}
+		out = append(out, fromGCSAttrs(attrs))
+	}
+	return out, nil
+}
+
+func (s *GCSStore) Stat(ctx context.Context, name string) (*ObjectAttrs, error) {
+	attrs, err := s.client.Bucket(s.bucket).Object(name).Attrs(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	a := fromGCSAttrs(attrs)
+	return &a, nil
+}
+
+func (s *GCSStore) Close() error {
+	return s.client.Close()
+}
+
+func fromGCSAttrs(attrs *gcs.ObjectAttrs) ObjectAttrs {
+	return ObjectAttrs{
+		Name:        attrs.Name,
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+		Updated:     attrs.Updated,
+	}
+}
+
+// StartResumable creates a GCS resumable upload session. The returned session
+// URI needs no further auth, so the browser can upload to it directly.
+func (s *GCSStore) StartResumable(ctx context.Context, name, contentType, origin string) (string, error) {
+	signed, err := s.client.Bucket(s.bucket).SignedURL(name, &gcs.SignedURLOptions{
+		Method:      "POST",
+		Expires:     time.Now().Add(15 * time.Minute),
+		ContentType: contentType,
+		Headers:     []string{"x-goog-resumable:start"},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, signed, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-goog-resumable", "start")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("start resumable upload: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("start resumable upload: %s: %s", resp.Status, body)
+	}
+	return resp.Header.Get("Location"), nil
+}
+
+// ResumableOffset asks GCS how much of the session it has persisted.
+func (s *GCSStore) ResumableOffset(ctx context.Context, sessionURL string, size int64) (int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sessionURL, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, false, fmt.Errorf("query resumable upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return size, true, nil
+	case http.StatusPermanentRedirect:
+		// Range: bytes=0-<last byte received>, absent if nothing arrived yet
+		rng := resp.Header.Get("Range")
+		if rng == "" {
+			return 0, false, nil
+		}
+		var last int64
+		if _, err := fmt.Sscanf(rng, "bytes=0-%d", &last); err != nil {
+			return 0, false, fmt.Errorf("unexpected Range header %q", rng)
+		}
+		return last + 1, false, nil
+	case http.StatusNotFound, http.StatusGone:
+		return 0, false, ErrNotExist
+	default:
+		return 0, false, fmt.Errorf("query resumable upload: %s", resp.Status)
+	}
+}
+
+// CancelResumable abandons a session so GCS discards what it received.
+func (s *GCSStore) CancelResumable(ctx context.Context, sessionURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, sessionURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// GCS answers a cancelled session with 499.
+	if resp.StatusCode != 499 && resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+		return fmt.Errorf("cancel resumable upload: %s", resp.Status)
+	}
+	return nil
+}
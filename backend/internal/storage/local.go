@@ -0,0 +1,380 @@
+// This file implements BlobStore on the local filesystem so the server can run
+// without a GCP bucket. Objects live under a root directory, and the API server
+// itself plays the part of GCS: it hands out HMAC-signed upload URLs and serves
+// the files back at /v1/blobs/<name>.
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const localRoutePrefix = "/v1/blobs/"
+
+// LocalStore keeps objects as files under root.
+type LocalStore struct {
+	root    string
+	baseURL string
+	key     []byte
+}
+
+// NewLocalStore creates root if needed. When signingKey is empty a random key
+// is generated, which means signed URLs stop working after a restart.
+func NewLocalStore(root, baseURL, signingKey string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	key := []byte(signingKey)
+	if len(key) == 0 {
+		log.Println("STORAGE_SIGNING_KEY not set, generating a temporary signing key")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &LocalStore{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		key:     key,
+	}, nil
+}
+
+// path maps an object name to a file under root, refusing names that would
+// escape it.
+func (s *LocalStore) path(name string) (string, error) {
+	clean := path.Clean("/" + name)
+	if name == "" || strings.HasSuffix(name, "/") || clean != "/"+name {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+// FilePath returns the on-disk path of an object, letting tools like ffprobe
+// read it without going through HTTP.
+func (s *LocalStore) FilePath(name string) (string, error) {
+	return s.path(name)
+}
+
+func (s *LocalStore) sign(method, name, contentType string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", method, name, contentType, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStore) signedURL(method, name, contentType string, expires time.Duration) string {
+	exp := time.Now().Add(expires).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(exp, 10))
+	q.Set("sig", s.sign(method, name, contentType, exp))
+	return s.PublicURL(name) + "?" + q.Encode()
+}
+
+func (s *LocalStore) SignedPutURL(ctx context.Context, name, contentType string, expires time.Duration) (string, error) {
+	if _, err := s.path(name); err != nil {
+		return "", err
+	}
+	return s.signedURL(http.MethodPut, name, contentType, expires), nil
+}
+
+func (s *LocalStore) SignedGetURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	if _, err := s.path(name); err != nil {
+		return "", err
+	}
+	return s.signedURL(http.MethodGet, name, "", expires), nil
+}
+
+func (s *LocalStore) PublicURL(name string) string {
+	return s.baseURL + localRoutePrefix + name
+}
+
+func (s *LocalStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	return f, err
+}
+
+// Create writes into a temp file next to the destination and renames it into
+// place on Close, so readers never see a half-written object.
+func (s *LocalStore) Create(ctx context.Context, name, contentType string) (Writer, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &localWriter{File: f, dest: p}, nil
+}
+
+type localWriter struct {
+	*os.File
+	dest string
+}
+
+func (w *localWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	return os.Rename(w.Name(), w.dest)
+}
+
+// Abort discards a write without touching the destination.
+func (w *localWriter) Abort() {
+	w.File.Close()
+	os.Remove(w.Name())
+}
+
+func (s *LocalStore) Delete(ctx context.Context, name string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]ObjectAttrs, error) {
+	var out []ObjectAttrs
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != s.root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, localAttrs(name, info))
+		return nil
+	})
+	return out, err
+}
+
+func (s *LocalStore) Stat(ctx context.Context, name string) (*ObjectAttrs, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	a := localAttrs(name, info)
+	return &a, nil
+}
+
+func (s *LocalStore) Close() error { return nil }
+
+// partPath is where an in-progress chunked upload is kept. The leading dot
+// keeps it out of List.
+func (s *LocalStore) partPath(uploadID string) (string, error) {
+	if uploadID == "" || strings.ContainsAny(uploadID, `/\.`) {
+		return "", fmt.Errorf("invalid upload id %q", uploadID)
+	}
+	return filepath.Join(s.root, ".uploads", uploadID), nil
+}
+
+func (s *LocalStore) WriteChunk(ctx context.Context, uploadID string, offset int64, r io.Reader) (int64, error) {
+	p, err := s.partPath(uploadID)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() != offset {
+		return info.Size(), ErrOffsetMismatch
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	// Whatever arrived before a dropped connection is kept, so the client can
+	// resume from the new offset.
+	n, err := io.Copy(f, r)
+	return offset + n, err
+}
+
+func (s *LocalStore) CompleteChunked(ctx context.Context, uploadID, name string) error {
+	part, err := s.partPath(uploadID)
+	if err != nil {
+		return err
+	}
+	dest, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Rename(part, dest)
+}
+
+func (s *LocalStore) AbortChunked(ctx context.Context, uploadID string) error {
+	p, err := s.partPath(uploadID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func localAttrs(name string, info fs.FileInfo) ObjectAttrs {
+	ct := mime.TypeByExtension(path.Ext(name))
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	return ObjectAttrs{Name: name, Size: info.Size(), ContentType: ct, Updated: info.ModTime()}
+}
+
+// RegisterRoutes mounts the upload/download endpoints the signed URLs point at.
+func (s *LocalStore) RegisterRoutes(r gin.IRoutes) {
+	r.PUT(localRoutePrefix+"*name", s.handlePut)
+	r.GET(localRoutePrefix+"*name", s.handleGet)
+	r.HEAD(localRoutePrefix+"*name", s.handleGet)
+}
+
+// verify checks the expires/sig query parameters against the request.
+func (s *LocalStore) verify(c *gin.Context, method, name, contentType string) bool {
+	exp, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	want := s.sign(method, name, contentType, exp)
+	return hmac.Equal([]byte(want), []byte(c.Query("sig")))
+}
+
+// PUT /v1/blobs/*name?expires=..&sig=..
+func (s *LocalStore) handlePut(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	if !s.verify(c, http.MethodPut, name, c.GetHeader("Content-Type")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid or expired signature"})
+		return
+	}
+	w, err := s.Create(c, name, c.GetHeader("Content-Type"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := io.Copy(w, c.Request.Body); err != nil {
+		w.Abort()
+		log.Printf("LocalStore: upload of %s failed: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "upload failed"})
+		return
+	}
+	if err := w.Close(); err != nil {
+		log.Printf("LocalStore: finishing upload of %s failed: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "upload failed"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// hidden reports whether name is kept out of unsigned downloads: partial
+// uploads and in-progress writes, which sit under dot-prefixed names, and
+// quarantined rejects.
+func hidden(name string) bool {
+	if strings.HasPrefix(name, "quarantine/") {
+		return true
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /v1/blobs/*name
+// Objects are readable without a signature, the same as the public-read bucket
+// used in production, except hidden ones, which need a signed URL. A
+// signature that is present must still be valid.
+func (s *LocalStore) handleGet(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	if c.Query("sig") != "" && !s.verify(c, http.MethodGet, name, "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid or expired signature"})
+		return
+	}
+	if c.Query("sig") == "" && hidden(name) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "object not found"})
+		return
+	}
+	p, err := s.path(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "object not found"})
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "object not found"})
+		return
+	}
+	c.Header("Content-Type", localAttrs(name, info).ContentType)
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,35 @@
+// This file defines the optional interfaces for uploads that can survive a
+// dropped connection. GCS has its own resumable session protocol; the local
+// store instead accepts chunks through the API's tus endpoint.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrOffsetMismatch is returned when a chunk doesn't start where the
+// previous one ended.
+var ErrOffsetMismatch = errors.New("storage: upload offset mismatch")
+
+// Resumable is implemented by stores with a native resumable upload protocol.
+type Resumable interface {
+	// StartResumable opens an upload session the client can PUT to directly.
+	// origin is the browser origin that will upload, for CORS.
+	StartResumable(ctx context.Context, name, contentType, origin string) (sessionURL string, err error)
+	// ResumableOffset reports how many bytes the session has received.
+	ResumableOffset(ctx context.Context, sessionURL string, size int64) (offset int64, complete bool, err error)
+	CancelResumable(ctx context.Context, sessionURL string) error
+}
+
+// Chunked is implemented by stores that receive uploads piece by piece
+// through the API server.
+type Chunked interface {
+	// WriteChunk appends r to the partial upload, which must currently be
+	// offset bytes long. It returns the new length.
+	WriteChunk(ctx context.Context, uploadID string, offset int64, r io.Reader) (int64, error)
+	// CompleteChunked turns the partial upload into the object name.
+	CompleteChunked(ctx context.Context, uploadID, name string) error
+	AbortChunked(ctx context.Context, uploadID string) error
+}
@@ -0,0 +1,112 @@
+// This file defines the storage layer that holds video files, thumbnails and
+// anything else we derive from an upload. Handlers and scripts only talk to the
+// BlobStore interface, so the same code runs against a Google Cloud Storage
+// bucket in production and against a plain directory on a developer's machine.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hi-wesley/mini-youtube/internal/config"
+)
+
+// ErrNotExist is returned when the requested object is not in the store.
+var ErrNotExist = errors.New("storage: object does not exist")
+
+// ObjectAttrs describes a stored object.
+type ObjectAttrs struct {
+	Name        string
+	Size        int64
+	ContentType string
+	Updated     time.Time
+}
+
+// Writer writes a new object. Close commits it; Abort discards the write
+// instead, leaving any existing object of the same name as it was. Callers
+// must call exactly one of them.
+type Writer interface {
+	io.WriteCloser
+	Abort()
+}
+
+// BlobStore is the set of operations the application needs from object storage.
+type BlobStore interface {
+	// SignedPutURL returns a URL the client can PUT the object to directly.
+	SignedPutURL(ctx context.Context, name, contentType string, expires time.Duration) (string, error)
+	// SignedGetURL returns a time-limited URL for downloading the object.
+	SignedGetURL(ctx context.Context, name string, expires time.Duration) (string, error)
+	// PublicURL returns the URL the frontend uses for publicly readable objects.
+	PublicURL(name string) string
+
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	Create(ctx context.Context, name, contentType string) (Writer, error)
+	Delete(ctx context.Context, name string) error
+	List(ctx context.Context, prefix string) ([]ObjectAttrs, error)
+	Stat(ctx context.Context, name string) (*ObjectAttrs, error)
+	Close() error
+}
+
+// Store is the process-wide blob store, set up by Init.
+var Store BlobStore
+
+// New builds the blob store selected by STORAGE_BACKEND.
+func New(ctx context.Context, cfg *config.Config) (BlobStore, error) {
+	switch cfg.StorageBackend {
+	case "", "gcs":
+		return NewGCSStore(ctx, cfg.GcsBucket)
+	case "local":
+		return NewLocalStore(cfg.LocalStorageDir, cfg.LocalStorageURL, cfg.StorageSigningKey)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
+
+// Init creates the configured blob store and assigns it to Store.
+func Init(ctx context.Context, cfg *config.Config) error {
+	s, err := New(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	Store = s
+	return nil
+}
+
+// ObjectName turns a URL returned by s.PublicURL back into the object name.
+func ObjectName(s BlobStore, url string) (string, bool) {
+	prefix := s.PublicURL("")
+	if url == "" || !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, prefix), true
+}
+
+// Move copies an object to a new name and deletes the original.
+func Move(ctx context.Context, s BlobStore, src, dst string) error {
+	attrs, err := s.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	r, err := s.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := s.Create(ctx, dst, attrs.ContentType)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Abort()
+		return fmt.Errorf("copy %s to %s: %w", src, dst, err)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return s.Delete(ctx, src)
+}
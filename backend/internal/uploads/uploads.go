@@ -0,0 +1,252 @@
+// This file manages resumable upload sessions for large videos. On GCS the
+// browser uploads straight to a resumable session URI; with local storage it
+// sends chunks to the API's tus endpoint. Either way a row in upload_sessions
+// records how far the upload got so the client can resume, and sessions that
+// go idle are cleaned up by a periodic job.
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/hi-wesley/mini-youtube/internal/config"
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/jobs"
+	"github.com/hi-wesley/mini-youtube/internal/media"
+	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
+)
+
+// JobCollect expires abandoned sessions.
+const JobCollect = "uploads.collect"
+
+var (
+	ErrNotFound    = errors.New("upload session not found")
+	ErrNotActive   = errors.New("upload session is no longer active")
+	ErrTooLarge    = errors.New("upload exceeds the maximum size")
+	ErrInvalidSize = errors.New("upload size must be positive")
+	ErrWrongProto  = errors.New("upload session uses a different protocol")
+	ErrLocked      = errors.New("upload session is busy with another request")
+	ErrUnsupported = errors.New("storage backend does not support resumable uploads")
+)
+
+// Register installs the garbage-collection job and schedules it hourly.
+func Register() {
+	jobs.Handle(JobCollect, func(ctx context.Context, _ struct{}) error {
+		return collect(ctx)
+	})
+	jobs.Every(time.Hour, JobCollect)
+}
+
+// Start opens a session for a size-byte upload of fileName. origin is passed
+// on to GCS so the browser may upload to the session cross-origin.
+func Start(ctx context.Context, uid, fileName, contentType string, size int64, origin string) (*models.UploadSession, error) {
+	cfg := config.Load()
+	if size <= 0 {
+		return nil, ErrInvalidSize
+	}
+	if size > cfg.MaxUploadBytes {
+		return nil, ErrTooLarge
+	}
+
+	s := &models.UploadSession{
+		ID:          uuid.NewString(),
+		UserID:      uid,
+		ObjectName:  media.NewUploadName(uid, fileName),
+		ContentType: contentType,
+		Size:        size,
+		Status:      models.UploadActive,
+		ExpiresAt:   time.Now().Add(cfg.UploadSessionTTL),
+	}
+	switch store := storage.Store.(type) {
+	case storage.Resumable:
+		url, err := store.StartResumable(ctx, s.ObjectName, contentType, origin)
+		if err != nil {
+			return nil, err
+		}
+		s.Protocol = models.UploadProtocolGCS
+		s.SessionURL = url
+	case storage.Chunked:
+		s.Protocol = models.UploadProtocolTus
+	default:
+		return nil, ErrUnsupported
+	}
+
+	if err := db.Conn.WithContext(ctx).Create(s).Error; err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get loads one of uid's sessions.
+func Get(ctx context.Context, uid, id string) (*models.UploadSession, error) {
+	var s models.UploadSession
+	err := db.Conn.WithContext(ctx).First(&s, "id = ? AND user_id = ?", id, uid).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	return &s, err
+}
+
+// Refresh brings a GCS session's offset up to date. tus sessions are always
+// current since every chunk passes through us.
+func Refresh(ctx context.Context, s *models.UploadSession) error {
+	if s.Status != models.UploadActive || s.Protocol != models.UploadProtocolGCS {
+		return nil
+	}
+	store, ok := storage.Store.(storage.Resumable)
+	if !ok {
+		return ErrUnsupported
+	}
+	offset, complete, err := store.ResumableOffset(ctx, s.SessionURL, s.Size)
+	if errors.Is(err, storage.ErrNotExist) {
+		// GCS dropped the session; nothing more can be sent to it.
+		return save(ctx, s, map[string]any{"status": models.UploadExpired})
+	}
+	if err != nil {
+		return err
+	}
+	updates := map[string]any{"offset": offset}
+	if complete {
+		updates["status"] = models.UploadCompleted
+	}
+	if offset != s.Offset || complete {
+		updates["expires_at"] = time.Now().Add(config.Load().UploadSessionTTL)
+	}
+	return save(ctx, s, updates)
+}
+
+var busy sync.Map // session ID -> struct{}, while a chunk is being written
+
+// WriteChunk appends r to a tus session at offset, and moves the file into
+// place once the last byte arrives. It returns the new offset, which is also
+// meaningful alongside an error: bytes received before a dropped connection
+// are kept.
+func WriteChunk(ctx context.Context, s *models.UploadSession, offset int64, r io.Reader) (int64, error) {
+	if s.Status != models.UploadActive {
+		return s.Offset, ErrNotActive
+	}
+	if s.Protocol != models.UploadProtocolTus {
+		return s.Offset, ErrWrongProto
+	}
+	store, ok := storage.Store.(storage.Chunked)
+	if !ok {
+		return s.Offset, ErrUnsupported
+	}
+	if _, loaded := busy.LoadOrStore(s.ID, struct{}{}); loaded {
+		return s.Offset, ErrLocked
+	}
+	defer busy.Delete(s.ID)
+
+	n, werr := store.WriteChunk(ctx, s.ID, offset, io.LimitReader(r, s.Size-offset))
+	if errors.Is(werr, storage.ErrOffsetMismatch) {
+		return n, werr
+	}
+
+	updates := map[string]any{
+		"offset":     n,
+		"expires_at": time.Now().Add(config.Load().UploadSessionTTL),
+	}
+	if werr == nil && n == s.Size {
+		if err := store.CompleteChunked(ctx, s.ID, s.ObjectName); err != nil {
+			return n, fmt.Errorf("complete upload: %w", err)
+		}
+		updates["status"] = models.UploadCompleted
+	}
+	if err := save(ctx, s, updates); err != nil {
+		return n, err
+	}
+	return n, werr
+}
+
+// Cancel abandons an unfinished session and discards what was received.
+func Cancel(ctx context.Context, s *models.UploadSession) error {
+	if s.Status != models.UploadActive && s.Status != models.UploadCompleted {
+		return ErrNotActive
+	}
+	if err := discard(ctx, s); err != nil {
+		return err
+	}
+	return save(ctx, s, map[string]any{"status": models.UploadCancelled})
+}
+
+// MarkFinalized records that a video now owns objectName, so the session's
+// object is never collected. Call it in the transaction creating the video.
+func MarkFinalized(tx *gorm.DB, objectName string) error {
+	return tx.Model(&models.UploadSession{}).
+		Where("object_name = ? AND status IN ?", objectName, []string{models.UploadActive, models.UploadCompleted}).
+		Update("status", models.UploadFinalized).Error
+}
+
+func save(ctx context.Context, s *models.UploadSession, updates map[string]any) error {
+	return db.Conn.WithContext(ctx).Model(s).Updates(updates).Error
+}
+
+// discard throws away whatever the session has stored so far.
+func discard(ctx context.Context, s *models.UploadSession) error {
+	if s.Status == models.UploadActive {
+		switch s.Protocol {
+		case models.UploadProtocolGCS:
+			if store, ok := storage.Store.(storage.Resumable); ok {
+				if err := store.CancelResumable(ctx, s.SessionURL); err != nil {
+					return err
+				}
+			}
+		case models.UploadProtocolTus:
+			if store, ok := storage.Store.(storage.Chunked); ok {
+				if err := store.AbortChunked(ctx, s.ID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// A GCS session can complete without us hearing about it, so check for
+	// the object in either state, leaving it alone if a video already owns it.
+	var owned int64
+	if err := db.Conn.WithContext(ctx).Model(&models.Video{}).Where("object_name = ?", s.ObjectName).Count(&owned).Error; err != nil {
+		return err
+	}
+	if owned > 0 {
+		return nil
+	}
+	if err := storage.Store.Delete(ctx, s.ObjectName); err != nil && !errors.Is(err, storage.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// collect expires sessions that went idle before being finalized.
+func collect(ctx context.Context) error {
+	var expired []models.UploadSession
+	err := db.Conn.WithContext(ctx).
+		Where("status IN ? AND expires_at < ?", []string{models.UploadActive, models.UploadCompleted}, time.Now()).
+		Limit(500).Find(&expired).Error
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for i := range expired {
+		s := &expired[i]
+		if err := discard(ctx, s); err != nil {
+			log.Printf("uploads: discarding session %s failed: %v", s.ID, err)
+			failed++
+			continue
+		}
+		if err := save(ctx, s, map[string]any{"status": models.UploadExpired}); err != nil {
+			return err
+		}
+	}
+	if len(expired) > 0 {
+		log.Printf("uploads: expired %d abandoned sessions (%d failed)", len(expired)-failed, failed)
+	}
+	return nil
+}
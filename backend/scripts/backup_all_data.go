@@ -10,11 +10,11 @@ import (
 	"path/filepath"
 	"time"
 
-	"cloud.google.com/go/storage"
 	firebase "firebase.google.com/go"
 	"github.com/hi-wesley/mini-youtube/internal/config"
 	"github.com/hi-wesley/mini-youtube/internal/db"
 	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
 	"github.com/joho/godotenv"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
@@ -27,6 +27,8 @@ type BackupData struct {
 	Comments  []models.Comment       `json:"comments"`
 	Likes     []models.Like          `json:"likes"`
 	Firebase  []FirebaseUser         `json:"firebase_users"`
+	// BlockedTerms is kept by user ID, since the user JSON leaves it out
+	BlockedTerms map[string][]string `json:"blocked_terms,omitempty"`
 }
 
 type FirebaseUser struct {
@@ -87,12 +89,12 @@ func main() {
 		log.Fatalf("Failed to write metadata file: %v", err)
 	}
 
-	// 3. Backup Google Cloud Storage
-	fmt.Println("\n3. Backing up Google Cloud Storage...")
-	if err := backupGoogleCloudStorage(ctx, cfg, backupDir); err != nil {
-		log.Printf("Error backing up GCS: %v", err)
+	// 3. Backup object storage
+	fmt.Println("\n3. Backing up object storage...")
+	if err := backupObjectStorage(ctx, cfg, backupDir); err != nil {
+		log.Printf("Error backing up object storage: %v", err)
 	} else {
-		fmt.Println("   ✓ Google Cloud Storage backed up")
+		fmt.Println("   ✓ Object storage backed up")
 	}
 
 	fmt.Printf("\n✅ Backup completed successfully!\n")
@@ -105,6 +107,12 @@ func backupDatabase(backup *BackupData) error {
 		return fmt.Errorf("failed to fetch users: %w", err)
 	}
 	fmt.Printf("   - Backed up %d users\n", len(backup.Users))
+	backup.BlockedTerms = map[string][]string{}
+	for _, u := range backup.Users {
+		if len(u.BlockedTerms) > 0 {
+			backup.BlockedTerms[u.ID] = u.BlockedTerms
+		}
+	}
 
 	// Backup videos
 	if err := db.Conn.Find(&backup.Videos).Error; err != nil {
@@ -112,8 +120,8 @@ func backupDatabase(backup *BackupData) error {
 	}
 	fmt.Printf("   - Backed up %d videos\n", len(backup.Videos))
 
-	// Backup comments
-	if err := db.Conn.Find(&backup.Comments).Error; err != nil {
+	// Backup comments, parents before their replies so they restore in order
+	if err := db.Conn.Order("id").Find(&backup.Comments).Error; err != nil {
 		return fmt.Errorf("failed to fetch comments: %w", err)
 	}
 	fmt.Printf("   - Backed up %d comments\n", len(backup.Comments))
@@ -165,33 +173,27 @@ func backupFirebaseAuth(ctx context.Context, backup *BackupData) error {
 	return nil
 }
 
-func backupGoogleCloudStorage(ctx context.Context, cfg *config.Config, backupDir string) error {
-	client, err := storage.NewClient(ctx)
+func backupObjectStorage(ctx context.Context, cfg *config.Config, backupDir string) error {
+	store, err := storage.New(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create storage client: %w", err)
 	}
-	defer client.Close()
+	defer store.Close()
 
-	bucket := client.Bucket(cfg.GcsBucket)
 	videosDir := filepath.Join(backupDir, "videos")
 	if err := os.MkdirAll(videosDir, 0755); err != nil {
 		return fmt.Errorf("failed to create videos directory: %w", err)
 	}
 
 	// List and download all objects
-	iter := bucket.Objects(ctx, nil)
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		return err
+	}
 	downloadedCount := 0
-	
-	for {
-		attrs, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("error iterating objects: %w", err)
-		}
 
-		// Create local file path preserving GCS structure
+	for _, attrs := range objects {
+		// Create local file path preserving the bucket structure
 		localPath := filepath.Join(videosDir, attrs.Name)
 		localDir := filepath.Dir(localPath)
 		if err := os.MkdirAll(localDir, 0755); err != nil {
@@ -200,7 +202,7 @@ func backupGoogleCloudStorage(ctx context.Context, cfg *config.Config, backupDir
 		}
 
 		// Download the object
-		rc, err := bucket.Object(attrs.Name).NewReader(ctx)
+		rc, err := store.Open(ctx, attrs.Name)
 		if err != nil {
 			log.Printf("Error reading object %s: %v", attrs.Name, err)
 			continue
@@ -228,4 +230,4 @@ func backupGoogleCloudStorage(ctx context.Context, cfg *config.Config, backupDir
 
 	fmt.Printf("   - Total files downloaded: %d\n", downloadedCount)
 	return nil
-}
\ No newline at end of file
+}
@@ -8,10 +8,10 @@ import (
 	"os"
 	"strings"
 
-	"cloud.google.com/go/storage"
 	firebase "firebase.google.com/go"
 	"github.com/hi-wesley/mini-youtube/internal/config"
 	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
 	"github.com/joho/godotenv"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
@@ -22,7 +22,7 @@ func main() {
 	fmt.Println("This will DELETE ALL DATA from:")
 	fmt.Println("1. Supabase (all videos, users, comments)")
 	fmt.Println("2. Firebase Authentication (all user accounts)")
-	fmt.Println("3. Google Cloud Storage (all video files)")
+	fmt.Println("3. Object storage (all video files)")
 	fmt.Println()
 	fmt.Print("Are you ABSOLUTELY SURE? Type 'DELETE ALL' to confirm: ")
 	
@@ -65,12 +65,12 @@ func main() {
 		fmt.Println("   ✓ Firebase Auth cleared")
 	}
 
-	// 3. Clear Google Cloud Storage
-	fmt.Println("\n3. Clearing Google Cloud Storage...")
-	if err := clearGoogleCloudStorage(ctx, cfg); err != nil {
-		log.Printf("Error clearing GCS: %v", err)
+	// 3. Clear object storage
+	fmt.Println("\n3. Clearing object storage...")
+	if err := clearObjectStorage(ctx, cfg); err != nil {
+		log.Printf("Error clearing object storage: %v", err)
 	} else {
-		fmt.Println("   ✓ Google Cloud Storage cleared")
+		fmt.Println("   ✓ Object storage cleared")
 	}
 
 	fmt.Println("\n✅ All data has been cleared successfully!")
@@ -82,9 +82,11 @@ func clearDatabase(cfg *config.Config) error {
 	}
 	database := db.Conn
 
-	// Delete in correct order due to foreign key constraints
-	tables := []string{"comments", "videos", "users"}
-	
+	// Deleting users cascades to their videos, comments, likes and
+	// everything derived from them. Jobs aren't tied to a row by a foreign
+	// key, so they are cleared separately.
+	tables := []string{"users", "jobs"}
+
 	for _, table := range tables {
 		result := database.Exec(fmt.Sprintf("DELETE FROM %s", table))
 		if result.Error != nil {
@@ -133,35 +135,28 @@ func clearFirebaseAuth(ctx context.Context) error {
 	return nil
 }
 
-func clearGoogleCloudStorage(ctx context.Context, cfg *config.Config) error {
-	client, err := storage.NewClient(ctx)
+func clearObjectStorage(ctx context.Context, cfg *config.Config) error {
+	store, err := storage.New(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create storage client: %w", err)
 	}
-	defer client.Close()
+	defer store.Close()
 
-	bucket := client.Bucket(cfg.GcsBucket)
-	
 	// List and delete all objects
-	iter := bucket.Objects(ctx, nil)
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		return err
+	}
 	deletedCount := 0
-	
-	for {
-		attrs, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("error iterating objects: %w", err)
-		}
 
-		if err := bucket.Object(attrs.Name).Delete(ctx); err != nil {
+	for _, attrs := range objects {
+		if err := store.Delete(ctx, attrs.Name); err != nil {
 			log.Printf("   - Error deleting object %s: %v", attrs.Name, err)
 		} else {
 			deletedCount++
 		}
 	}
 
-	fmt.Printf("   - Deleted %d objects from GCS bucket %s\n", deletedCount, cfg.GcsBucket)
+	fmt.Printf("   - Deleted %d objects from %s storage\n", deletedCount, cfg.StorageBackend)
 	return nil
-}
\ No newline at end of file
+}
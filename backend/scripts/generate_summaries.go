@@ -2,17 +2,22 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 
-	"cloud.google.com/go/vertexai/genai"
+	"github.com/hi-wesley/mini-youtube/internal/ai"
 	"github.com/hi-wesley/mini-youtube/internal/config"
 	"github.com/hi-wesley/mini-youtube/internal/db"
 	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	videoID := flag.String("video", "", "only regenerate the summary for this video ID")
+	flag.Parse()
+
 	fmt.Println("=== Generate Summaries for Existing Videos ===")
 
 	// Load .env file
@@ -29,108 +34,49 @@ func main() {
 	}
 
 	ctx := context.Background()
+	if err := storage.Init(ctx, cfg); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer storage.Store.Close()
 
-	// Create Vertex AI client
-	client, err := genai.NewClient(ctx, cfg.ProjectID, cfg.Region)
+	// Same summarizer the server uses, picked by AI_PROVIDER
+	summarizer, err := ai.New(ctx, cfg)
 	if err != nil {
-		log.Fatalf("Failed to create genai client: %v", err)
-		return
+		log.Fatalf("Failed to create summarizer: %v", err)
+	}
+	if summarizer == nil {
+		log.Fatalf("AI_PROVIDER is 'none', nothing to do")
 	}
-	defer client.Close()
+	defer summarizer.Close()
 
 	// Get all videos (regenerate summaries for all)
 	var videos []models.Video
-	if err := db.Conn.Find(&videos).Error; err != nil {
+	query := db.Conn
+	if *videoID != "" {
+		query = query.Where("id = ?", *videoID)
+	}
+	if err := query.Find(&videos).Error; err != nil {
 		log.Fatalf("Failed to fetch videos: %v", err)
 	}
 
-	fmt.Printf("Found %d videos total. Regenerating summaries for all.\n", len(videos))
-
-	modelName := "gemini-2.5-pro"
-	model := client.GenerativeModel(modelName)
+	fmt.Printf("Found %d videos. Regenerating summaries with %s (%s).\n", len(videos), cfg.AIProvider, summarizer.Model())
 
 	// Process each video
-	for i, video := range videos {
+	for i := range videos {
+		video := &videos[i]
 		fmt.Printf("\n[%d/%d] Processing video: %s\n", i+1, len(videos), video.Title)
-		
-		gcsURI := fmt.Sprintf("gs://%s/%s", cfg.GcsBucket, video.ObjectName)
-		fmt.Printf("  GCS URI: %s\n", gcsURI)
 
-		// Generate summary
-		resp, err := model.GenerateContent(ctx, 
-			genai.FileData{
-				MIMEType: "video/mp4", 
-				FileURI: gcsURI,
-			}, 
-			genai.Text("Summarize this video in 3 concise sentences."),
-		)
-		
-		if err != nil {
+		if err := ai.AnalyzeAndStore(ctx, summarizer, video); err != nil {
 			log.Printf("  ERROR generating summary: %v", err)
-			
-			// Try to get more details about the error
-			fmt.Printf("  Full error details: %+v\n", err)
-			
-			// Common issues:
-			// - File not found in GCS
-			// - Permissions issue
-			// - Region mismatch
-			// - API not enabled
 			continue
 		}
 
-		// Extract summary from response
-		if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-			summary := resp.Candidates[0].Content.Parts[0].(genai.Text)
-			
-			// Update database
-			if err := db.Conn.Model(&models.Video{}).
-				Where("id = ?", video.ID).
-				Updates(map[string]interface{}{
-					"summary":       string(summary),
-					"summary_model": modelName,
-				}).Error; err != nil {
-				log.Printf("  ERROR updating database: %v", err)
-			} else {
-				fmt.Printf("  SUCCESS: Summary generated and saved\n")
-				fmt.Printf("  Summary: %s\n", summary)
-			}
-		} else {
-			fmt.Printf("  ERROR: No summary in response\n")
+		var updated models.Video
+		if err := db.Conn.Select("summary").First(&updated, "id = ?", video.ID).Error; err == nil {
+			fmt.Printf("  SUCCESS: Summary generated and saved\n")
+			fmt.Printf("  Summary: %s\n", updated.Summary)
 		}
 	}
 
 	fmt.Println("\nDone!")
 }
-
-// Debug function to test a single video
-func testSingleVideo(ctx context.Context, client *genai.Client, videoID string) {
-	var video models.Video
-	if err := db.Conn.Where("id = ?", videoID).First(&video).Error; err != nil {
-		log.Printf("Video not found: %v", err)
-		return
-	}
-
-	cfg := config.Load()
-	gcsURI := fmt.Sprintf("gs://%s/%s", cfg.GcsBucket, video.ObjectName)
-	
-	fmt.Printf("Testing video: %s\n", video.Title)
-	fmt.Printf("GCS URI: %s\n", gcsURI)
-	
-	model := client.GenerativeModel("gemini-2.5-flash")
-	
-	resp, err := model.GenerateContent(ctx, 
-		genai.FileData{
-			MIMEType: "video/mp4", 
-			FileURI: gcsURI,
-		}, 
-		genai.Text("Summarize this video in 3 concise sentences."),
-	)
-	
-	if err != nil {
-		fmt.Printf("Error: %+v\n", err)
-		return
-	}
-	
-	fmt.Printf("Response: %+v\n", resp)
-}
\ No newline at end of file
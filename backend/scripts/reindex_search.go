@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/hi-wesley/mini-youtube/internal/config"
+	"github.com/hi-wesley/mini-youtube/internal/db"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	batch := flag.Int("batch", 500, "videos to update per statement")
+	flag.Parse()
+
+	fmt.Println("=== Rebuild Video Search Index ===")
+
+	// Load .env file
+	if err := godotenv.Load("../.env"); err != nil {
+		if err := godotenv.Load(".env"); err != nil {
+			log.Println("Warning: Could not load .env file, using environment variables")
+		}
+	}
+
+	cfg := config.Load()
+	if err := db.Connect(cfg.DB); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	ctx := context.Background()
+
+	// Make sure the column, trigger and index exist before filling them
+	if _, err := db.MigrateUp(ctx); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	n, err := db.ReindexSearch(ctx, *batch)
+	if err != nil {
+		log.Fatalf("Reindex failed after %d videos: %v", n, err)
+	}
+	fmt.Printf("Reindexed %d videos.\n", n)
+}
@@ -6,16 +6,17 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"cloud.google.com/go/storage"
 	firebase "firebase.google.com/go"
 	"firebase.google.com/go/auth"
 	"github.com/hi-wesley/mini-youtube/internal/config"
 	"github.com/hi-wesley/mini-youtube/internal/db"
 	"github.com/hi-wesley/mini-youtube/internal/models"
+	"github.com/hi-wesley/mini-youtube/internal/storage"
 	"github.com/joho/godotenv"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
@@ -28,6 +29,8 @@ type BackupData struct {
 	Comments  []models.Comment `json:"comments"`
 	Likes     []models.Like    `json:"likes"`
 	Firebase  []FirebaseUser   `json:"firebase_users"`
+	// BlockedTerms is kept by old user ID, since the user JSON leaves it out
+	BlockedTerms map[string][]string `json:"blocked_terms"`
 }
 
 type FirebaseUser struct {
@@ -97,12 +100,12 @@ func main() {
 		fmt.Println("   ✓ Firebase Auth restored with UID mappings")
 	}
 
-	// 3. Restore Google Cloud Storage
-	fmt.Println("\n3. Restoring Google Cloud Storage...")
-	if err := restoreGoogleCloudStorage(ctx, cfg, backupDir); err != nil {
-		log.Printf("Error restoring GCS: %v", err)
+	// 3. Restore object storage
+	fmt.Println("\n3. Restoring object storage...")
+	if err := restoreObjectStorage(ctx, cfg, backupDir); err != nil {
+		log.Printf("Error restoring object storage: %v", err)
 	} else {
-		fmt.Println("   ✓ Google Cloud Storage restored")
+		fmt.Println("   ✓ Object storage restored")
 	}
 
 	// 4. Restore Supabase Database (using UID mappings from step 2)
@@ -158,33 +161,27 @@ func clearAllData(ctx context.Context, cfg *config.Config) error {
 	}
 	fmt.Printf("   - Deleted %d Firebase users\n", deletedCount)
 
-	// Clear GCS
-	storageClient, err := storage.NewClient(ctx)
+	// Clear object storage
+	store, err := storage.New(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create storage client: %w", err)
 	}
-	defer storageClient.Close()
+	defer store.Close()
 
-	bucket := storageClient.Bucket(cfg.GcsBucket)
-	iter2 := bucket.Objects(ctx, nil)
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		return err
+	}
 	deletedFiles := 0
-	
-	for {
-		attrs, err := iter2.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("error iterating objects: %w", err)
-		}
 
-		if err := bucket.Object(attrs.Name).Delete(ctx); err != nil {
+	for _, attrs := range objects {
+		if err := store.Delete(ctx, attrs.Name); err != nil {
 			log.Printf("Error deleting object %s: %v", attrs.Name, err)
 		} else {
 			deletedFiles++
 		}
 	}
-	fmt.Printf("   - Deleted %d files from GCS\n", deletedFiles)
+	fmt.Printf("   - Deleted %d files from object storage\n", deletedFiles)
 
 	return nil
 }
@@ -192,6 +189,7 @@ func clearAllData(ctx context.Context, cfg *config.Config) error {
 func restoreDatabase(backup BackupData) error {
 	// Restore users with mapped UIDs
 	for _, user := range backup.Users {
+		user.BlockedTerms = backup.BlockedTerms[user.ID]
 		// Update user ID to new Firebase UID
 		if newUID, ok := uidMapping[user.ID]; ok {
 			user.ID = newUID
@@ -307,14 +305,13 @@ func restoreFirebaseAuth(ctx context.Context, users []FirebaseUser) error {
 	return nil
 }
 
-func restoreGoogleCloudStorage(ctx context.Context, cfg *config.Config, backupDir string) error {
-	client, err := storage.NewClient(ctx)
+func restoreObjectStorage(ctx context.Context, cfg *config.Config, backupDir string) error {
+	store, err := storage.New(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create storage client: %w", err)
 	}
-	defer client.Close()
+	defer store.Close()
 
-	bucket := client.Bucket(cfg.GcsBucket)
 	videosDir := filepath.Join(backupDir, "videos")
 
 	// Walk through all files in the backup
@@ -328,12 +325,12 @@ func restoreGoogleCloudStorage(ctx context.Context, cfg *config.Config, backupDi
 			return nil
 		}
 
-		// Calculate GCS object name
+		// Calculate object name
 		relPath, err := filepath.Rel(videosDir, path)
 		if err != nil {
 			return err
 		}
-		gcsPath := strings.ReplaceAll(relPath, string(os.PathSeparator), "/")
+		objectName := strings.ReplaceAll(relPath, string(os.PathSeparator), "/")
 
 		// Open local file
 		file, err := os.Open(path)
@@ -343,19 +340,24 @@ func restoreGoogleCloudStorage(ctx context.Context, cfg *config.Config, backupDi
 		}
 		defer file.Close()
 
-		// Upload to GCS
-		wc := bucket.Object(gcsPath).NewWriter(ctx)
+		// Upload to the blob store
+		wc, err := store.Create(ctx, objectName, mime.TypeByExtension(filepath.Ext(path)))
+		if err != nil {
+			log.Printf("Error creating writer for %s: %v", objectName, err)
+			return nil
+		}
 		if _, err := io.Copy(wc, file); err != nil {
-			log.Printf("Error uploading %s: %v", gcsPath, err)
+			wc.Abort()
+			log.Printf("Error uploading %s: %v", objectName, err)
 			return nil
 		}
 		if err := wc.Close(); err != nil {
-			log.Printf("Error closing writer for %s: %v", gcsPath, err)
+			log.Printf("Error closing writer for %s: %v", objectName, err)
 			return nil
 		}
 
 		uploadedCount++
-		fmt.Printf("   - Uploaded: %s\n", gcsPath)
+		fmt.Printf("   - Uploaded: %s\n", objectName)
 		return nil
 	})
 
@@ -0,0 +1,160 @@
+// This page shows a user's channel: their banner, bio and links, a few
+// totals, a subscribe button, and the videos they uploaded.
+import { useInfiniteQuery, useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
+import { useContext } from 'react';
+import { Link, useParams } from 'react-router-dom';
+import api from '../api/axios';
+import { AuthCtx } from './AuthProvider';
+
+interface ProfileLink {
+  Title: string;
+  URL: string;
+}
+
+interface Channel {
+  user: {
+    ID: string;
+    Username: string;
+    Bio: string;
+    BannerURL: string;
+    Links: ProfileLink[];
+    CreatedAt: string;
+  };
+  stats: {
+    videoCount: number;
+    totalViews: number;
+    subscriberCount: number;
+  };
+  subscribed: boolean;
+}
+
+interface Video {
+  ID: string;
+  Title: string;
+  ThumbnailURL: string;
+  Views: number;
+}
+
+interface PlaylistSummary {
+  ID: string;
+  Title: string;
+  ItemCount: number;
+}
+
+interface VideoPage {
+  videos: Video[];
+  nextCursor: string;
+}
+
+export default function ChannelPage() {
+  const { username } = useParams<{ username: string }>();
+  const auth = useContext(AuthCtx);
+  const queryClient = useQueryClient();
+  const { data: channel, isLoading, error } = useQuery<Channel>({
+    queryKey: ['channel', username],
+    queryFn: () => api.get(`/v1/users/${encodeURIComponent(username!)}`).then(res => res.data),
+    enabled: !!username && !auth?.loading, // the response depends on who is asking
+  });
+  const { data: playlists } = useQuery<{ playlists: PlaylistSummary[] }>({
+    queryKey: ['channel-playlists', username],
+    queryFn: () => api.get(`/v1/users/${encodeURIComponent(username!)}/playlists`).then(res => res.data),
+    enabled: !!channel,
+  });
+  const subscribeMutation = useMutation({
+    mutationFn: (subscribe: boolean) => {
+      const url = `/v1/users/${encodeURIComponent(username!)}/subscribe`;
+      return subscribe ? api.put(url) : api.delete(url);
+    },
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ['channel', username] });
+      queryClient.invalidateQueries({ queryKey: ['videos', '/v1/feed/subscriptions'] });
+    },
+  });
+
+  const handleSubscribe = () => {
+    if (!auth?.user) {
+      alert('You are not logged in');
+      return;
+    }
+    subscribeMutation.mutate(!channel?.subscribed);
+  };
+  const videos = useInfiniteQuery<VideoPage>({
+    queryKey: ['channel-videos', username],
+    queryFn: ({ pageParam }) =>
+      api.get(`/v1/users/${encodeURIComponent(username!)}/videos`, { params: { cursor: pageParam || undefined } }).then(res => res.data),
+    initialPageParam: '',
+    getNextPageParam: (lastPage) => lastPage.nextCursor || undefined,
+    enabled: !!channel,
+  });
+
+  if (isLoading) return <div className="text-center p-10">Loading channel...</div>;
+  if (error || !channel) return <div className="text-center p-10 text-red-500">Channel not found</div>;
+
+  const { user, stats } = channel;
+  const isOwnChannel = auth?.user?.uid === user.ID;
+  return (
+    <main className="flex-1 p-4 sm:p-6">
+      {user.BannerURL && (
+        <img src={user.BannerURL} alt="" className="w-full h-40 sm:h-56 object-cover rounded-xl mb-6" />
+      )}
+      <div className="flex items-center gap-4">
+        <h1 className="text-2xl font-bold text-gray-900">{user.Username}</h1>
+        {!isOwnChannel && (
+          <button
+            onClick={handleSubscribe}
+            disabled={subscribeMutation.isPending}
+            className={`px-4 py-1.5 rounded-full text-sm font-medium disabled:opacity-50 ${
+              channel.subscribed ? 'bg-gray-100 text-gray-900 hover:bg-gray-200' : 'bg-gray-900 text-white hover:bg-gray-700'
+            }`}
+          >
+            {channel.subscribed ? 'Subscribed' : 'Subscribe'}
+          </button>
+        )}
+      </div>
+      <p className="text-sm text-gray-600 mt-1">
+        {stats.subscriberCount} subscribers &bull; {stats.videoCount} videos &bull; {stats.totalViews} views
+      </p>
+      {user.Bio && <p className="text-gray-800 mt-3 whitespace-pre-line">{user.Bio}</p>}
+      {user.Links.length > 0 && (
+        <div className="flex flex-wrap gap-3 mt-3">
+          {user.Links.map(link => (
+            <a key={link.URL} href={link.URL} target="_blank" rel="noopener noreferrer nofollow" className="text-sm text-blue-600 hover:underline">
+              {link.Title}
+            </a>
+          ))}
+        </div>
+      )}
+
+      {!!playlists?.playlists.length && (
+        <div className="flex flex-wrap gap-2 mt-6">
+          {playlists.playlists.map(pl => (
+            <Link key={pl.ID} to={`/playlist/${pl.ID}`} className="px-3 py-1 rounded-lg bg-gray-100 text-sm text-gray-900 hover:bg-gray-200">
+              {pl.Title} ({pl.ItemCount})
+            </Link>
+          ))}
+        </div>
+      )}
+
+      <div className="grid grid-cols-1 sm:grid-cols-2 md:grid-cols-3 lg:grid-cols-4 xl:grid-cols-5 gap-x-4 gap-y-8 mt-8">
+        {videos.data?.pages.flatMap(page => page.videos).map(video => (
+          <Link to={`/watch/${video.ID}`} key={video.ID} className="flex flex-col">
+            <img src={video.ThumbnailURL} alt={video.Title} className="w-full h-auto rounded-xl object-cover aspect-video" />
+            <p className="text-base font-medium text-gray-900 leading-tight break-words mt-3">{video.Title}</p>
+            <p className="text-sm text-gray-600">{video.Views} views</p>
+          </Link>
+        ))}
+      </div>
+      {videos.hasNextPage && (
+        <div className="flex justify-center mt-8">
+          <button
+            onClick={() => videos.fetchNextPage()}
+            disabled={videos.isFetchingNextPage}
+            className="px-4 py-2 rounded-full bg-gray-100 text-gray-900 text-sm hover:bg-gray-200 disabled:opacity-50"
+          >
+            {videos.isFetchingNextPage ? 'Loading...' : 'Load more'}
+          </button>
+        </div>
+      )}
+    </main>
+  );
+}
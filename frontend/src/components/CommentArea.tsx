@@ -1,56 +1,325 @@
 // This component handles the entire comment section for a video.
-// It fetches the initial list of comments and then establishes a WebSocket
-// connection to receive and display new comments in real-time. It also
-// contains the form for users to submit new comments.
+// It fetches top-level comments a page at a time, loads replies when a
+// thread is expanded, and establishes a WebSocket connection to receive new,
+// edited and deleted comments in real-time. Authors can edit and delete their
+// own comments, and it contains the forms for posting comments and replies.
+// The same socket carries the video's live like and view counts, which are
+// written into the video's query, and how many people are watching, which
+// is passed up through onWatching. Comments can come back held for review
+// or rejected by moderation; the video's owner gets a queue of held comments
+// to approve or deny.
 import React, { useEffect, useState } from 'react';
-import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
+import { InfiniteData, useInfiniteQuery, useMutation, useQueryClient } from '@tanstack/react-query';
+import axios from 'axios';
 import api from '../api/axios';
 import { getAuth } from 'firebase/auth';
 
 interface Comment {
   ID: number;
   UserID: string;
+  VideoID: string;
+  ParentID: number | null;
   Message: string;
   CreatedAt: string;
+  EditedAt?: string;
+  DeletedAt?: string;
+  Status: 'published' | 'held';
+  HeldReason?: string;
+  ReplyCount: number;
   User: {
     Username: string;
   };
 }
 
-export default function CommentArea({videoId}:{videoId:string}) {
-  const [ws, setWs] = useState<WebSocket|null>(null);
-  const [msg, setMsg] = useState('');
+interface CommentPage {
+  comments: Comment[];
+  nextCursor: string;
+}
+
+// Every socket message is a versioned {v, type, data} envelope. Unknown
+// types are ignored.
+interface SocketEvent {
+  v: number;
+  type: string;
+  data: unknown;
+}
+
+interface CountEvent {
+  videoId: string;
+  delta: number;
+  likes?: number;
+  views?: number;
+}
+
+type Pages = InfiniteData<CommentPage>;
+
+// The list a comment belongs in: the video's top-level comments or the
+// replies to its parent.
+const listKey = (c: Pick<Comment, 'VideoID' | 'ParentID'>) =>
+  c.ParentID ? ['replies', c.ParentID] : ['comments', c.VideoID];
+
+// moderationNotice explains a posted comment that didn't go up straight
+// away: 202 means it was held, 422 that it was rejected.
+function moderationNotice(status: number | undefined, reason?: string): string {
+  if (status === 202) return 'Your comment is held for review by the channel owner.';
+  if (status === 422) return `Your comment was not posted${reason ? ` (${reason})` : ''}.`;
+  return '';
+}
+
+const errorNotice = (err: unknown) =>
+  axios.isAxiosError(err) ? moderationNotice(err.response?.status, err.response?.data?.reason) : '';
+
+function updatePages(pages: Pages | undefined, fn: (comments: Comment[]) => Comment[]): Pages | undefined {
+  if (!pages) return pages;
+  return { ...pages, pages: pages.pages.map(p => ({ ...p, comments: fn(p.comments) })) };
+}
+
+function CommentItem({ comment, videoId }: { comment: Comment; videoId: string }) {
   const auth = getAuth();
   const queryClient = useQueryClient();
+  const [showReplies, setShowReplies] = useState(false);
+  const [replying, setReplying] = useState(false);
+  const [editing, setEditing] = useState(false);
+  const [reply, setReply] = useState('');
+  const [draft, setDraft] = useState(comment.Message);
+  const [notice, setNotice] = useState('');
+
+  const replies = useInfiniteQuery<CommentPage>({
+    queryKey: ['replies', comment.ID],
+    queryFn: ({ pageParam }) =>
+      api.get(`/v1/comments/${comment.ID}/replies`, { params: { cursor: pageParam || undefined } }).then(r => r.data),
+    initialPageParam: '',
+    getNextPageParam: (lastPage) => lastPage.nextCursor || undefined,
+    enabled: showReplies,
+  });
+
+  const replyMutation = useMutation({
+    mutationFn: (message: string) => api.post('/v1/comments', { video_id: videoId, message, parent_id: comment.ID }),
+    onSuccess: res => {
+      setReply('');
+      setReplying(false);
+      setShowReplies(true);
+      setNotice(moderationNotice(res.status));
+      queryClient.invalidateQueries({ queryKey: ['replies', comment.ID] });
+    },
+    onError: err => setNotice(errorNotice(err)),
+  });
+  const editMutation = useMutation({
+    mutationFn: (message: string) => api.patch(`/v1/comments/${comment.ID}`, { message }),
+    onSuccess: () => {
+      setEditing(false);
+      setNotice('');
+      queryClient.invalidateQueries({ queryKey: listKey(comment) });
+    },
+    onError: err => {
+      if (axios.isAxiosError(err) && err.response?.status === 422) {
+        const reason = err.response.data?.reason;
+        setNotice(`Your edit was not saved${reason ? ` (${reason})` : ''}.`);
+      }
+    },
+  });
+  const deleteMutation = useMutation({
+    mutationFn: () => api.delete(`/v1/comments/${comment.ID}`),
+    onSuccess: () => queryClient.invalidateQueries({ queryKey: listKey(comment) }),
+  });
+
+  const isAuthor = !!auth.currentUser && auth.currentUser.uid === comment.UserID;
+  const replyCount = comment.ReplyCount;
+
+  return (
+    <div style={{ marginBottom: '1rem', paddingBottom: '0.5rem', borderBottom: comment.ParentID ? undefined : '1px solid #e5e7eb' }}>
+      <div style={{ display: 'flex', alignItems: 'center' }}>
+        <p style={{ fontWeight: 'normal' }}>{comment.DeletedAt ? '' : comment.User?.Username || 'User'}</p>
+        <p style={{ color: '#6b7280', fontSize: '0.875rem', marginLeft: comment.DeletedAt ? 0 : '1rem' }}>
+          {new Date(comment.CreatedAt).toLocaleString([], {year: 'numeric', month: 'numeric', day: 'numeric', hour: '2-digit', minute:'2-digit'})}
+          {comment.EditedAt && !comment.DeletedAt && ' (edited)'}
+        </p>
+      </div>
+      {comment.DeletedAt ? (
+        <p style={{ marginTop: '0', color: '#6b7280', fontStyle: 'italic' }}>This comment was deleted.</p>
+      ) : editing ? (
+        <form onSubmit={e => { e.preventDefault(); editMutation.mutate(draft); }}>
+          <textarea value={draft} onChange={e => setDraft(e.target.value)} className="w-full p-2 border rounded-lg" />
+          <button type="submit" className="mt-1 px-3 py-1 rounded-lg bg-blue-500 text-white text-sm">Save</button>
+          <button type="button" onClick={() => { setEditing(false); setDraft(comment.Message); }} className="mt-1 ml-2 px-3 py-1 text-sm text-gray-600">Cancel</button>
+        </form>
+      ) : (
+        <p style={{ marginTop: '0' }}>{comment.Message}</p>
+      )}
+
+      <div className="flex gap-3 text-sm text-gray-600">
+        {!comment.DeletedAt && auth.currentUser && (
+          <button type="button" onClick={() => setReplying(!replying)} className="hover:text-gray-900">Reply</button>
+        )}
+        {isAuthor && !comment.DeletedAt && !editing && (
+          <>
+            <button type="button" onClick={() => setEditing(true)} className="hover:text-gray-900">Edit</button>
+            <button type="button" onClick={() => deleteMutation.mutate()} className="hover:text-red-600">Delete</button>
+          </>
+        )}
+        {replyCount > 0 && (
+          <button type="button" onClick={() => setShowReplies(!showReplies)} className="text-blue-600">
+            {showReplies ? 'Hide replies' : `${replyCount} ${replyCount === 1 ? 'reply' : 'replies'}`}
+          </button>
+        )}
+      </div>
+
+      {notice && <p className="text-sm text-gray-600 mt-1">{notice}</p>}
+
+      {replying && (
+        <form onSubmit={e => { e.preventDefault(); if (reply.trim()) replyMutation.mutate(reply); }} className="mt-2">
+          <textarea value={reply} onChange={e => setReply(e.target.value)} className="w-full p-2 border rounded-lg" placeholder="Add a reply..." />
+          <button type="submit" className={`mt-1 px-3 py-1 rounded-lg text-sm ${reply.trim() ? 'bg-blue-500 text-white' : 'bg-gray-300 text-gray-600'}`}>Reply</button>
+        </form>
+      )}
+
+      {showReplies && (
+        <div style={{ marginLeft: '1.5rem', marginTop: '0.5rem' }}>
+          {replies.data?.pages.flatMap(p => p.comments).map(r => (
+            <CommentItem key={r.ID} comment={r} videoId={videoId} />
+          ))}
+          {replies.hasNextPage && (
+            <button type="button" onClick={() => replies.fetchNextPage()} className="text-sm text-blue-600">More replies</button>
+          )}
+        </div>
+      )}
+    </div>
+  );
+}
 
-  const {data:initial} = useQuery<Comment[]>({ 
-    queryKey:['comments',videoId], 
-    queryFn:()=>api.get(`/v1/videos/${videoId}/comments`).then(r=>r.data)
+// HeldComments is the owner's queue of comments moderation held back.
+function HeldComments({ videoId }: { videoId: string }) {
+  const queryClient = useQueryClient();
+  const held = useInfiniteQuery<CommentPage>({
+    queryKey: ['held', videoId],
+    queryFn: ({ pageParam }) =>
+      api.get(`/v1/videos/${videoId}/comments/held`, { params: { cursor: pageParam || undefined } }).then(r => r.data),
+    initialPageParam: '',
+    getNextPageParam: (lastPage) => lastPage.nextCursor || undefined,
+  });
+  const review = useMutation({
+    mutationFn: ({ id, action }: { id: number; action: 'approve' | 'deny' }) => api.post(`/v1/comments/${id}/${action}`),
+    // Approved comments reach the lists through the socket.
+    onSuccess: () => queryClient.invalidateQueries({ queryKey: ['held', videoId] }),
   });
+  const comments = held.data?.pages.flatMap(p => p.comments) ?? [];
+  if (comments.length === 0) return null;
 
-  const [comments,setComments] = useState<Comment[]>([]);
-  useEffect(()=>{ if(initial) setComments(initial); }, [initial]);
+  return (
+    <div className="mb-4 p-3 rounded-lg bg-white">
+      <h3 className="font-bold mb-2">Held for review ({comments.length}{held.hasNextPage ? '+' : ''})</h3>
+      {comments.map(c => (
+        <div key={c.ID} className="mb-2 pb-2 border-b border-gray-200">
+          <p className="text-sm text-gray-600">{c.User?.Username || 'User'} • {c.HeldReason}</p>
+          <p>{c.Message}</p>
+          <div className="flex gap-3 text-sm">
+            <button type="button" disabled={review.isPending} onClick={() => review.mutate({ id: c.ID, action: 'approve' })} className="text-blue-600">Approve</button>
+            <button type="button" disabled={review.isPending} onClick={() => review.mutate({ id: c.ID, action: 'deny' })} className="text-red-600">Deny</button>
+          </div>
+        </div>
+      ))}
+      {held.hasNextPage && (
+        <button type="button" onClick={() => held.fetchNextPage()} className="text-sm text-blue-600">More</button>
+      )}
+    </div>
+  );
+}
+
+export default function CommentArea({videoId, ownerId, onWatching}:{videoId:string; ownerId?: string; onWatching?: (watching: number) => void}) {
+  const [msg, setMsg] = useState('');
+  const [notice, setNotice] = useState('');
+  const auth = getAuth();
+  const queryClient = useQueryClient();
+
+  const { data, fetchNextPage, hasNextPage, isFetchingNextPage } = useInfiniteQuery<CommentPage>({
+    queryKey: ['comments', videoId],
+    queryFn: ({ pageParam }) =>
+      api.get(`/v1/videos/${videoId}/comments`, { params: { cursor: pageParam || undefined } }).then(r => r.data),
+    initialPageParam: '',
+    getNextPageParam: (lastPage) => lastPage.nextCursor || undefined,
+  });
+  const comments = data?.pages.flatMap(p => p.comments) ?? [];
 
   useEffect(()=>{
+    let socket: WebSocket | null = null;
+    let closed = false;
+    let retry: ReturnType<typeof setTimeout> | undefined;
     const openSocket = async () => {
-      const user = auth.currentUser;
-      if (!user) return;
-      const token = await user.getIdToken();
-      const socket = new WebSocket(`${import.meta.env.VITE_WS_URL}/v1/ws/comments?vid=${videoId}&token=${token}`);
-      
+      // Trade our login, if any, for a short-lived ticket; it goes in the
+      // subprotocol list so it stays out of the URL. Logged-out viewers get
+      // an anonymous one.
+      let ticket: { ticket: string; protocol: string };
+      try {
+        ticket = (await api.post('/v1/ws/tickets', { videoId })).data;
+      } catch {
+        return;
+      }
+      if (closed) return;
+      socket = new WebSocket(`${import.meta.env.VITE_WS_URL}/v1/ws/comments?vid=${videoId}`, [ticket.protocol, ticket.ticket]);
+
       socket.onmessage = e => {
-        const c:Comment = JSON.parse(e.data);
-        setComments(prev => {
-          if (prev.find(pc => pc.ID === c.ID)) return prev;
-          return [c, ...prev]
-        });
+        const { type, data }: SocketEvent = JSON.parse(e.data);
+        switch (type) {
+          case 'video.likes':
+          case 'video.views': {
+            // Take the count as sent rather than adding the delta, so our
+            // own like doesn't count twice once its refetch lands.
+            const { likes, views } = data as CountEvent;
+            queryClient.setQueryData<{ Likes: number; Views: number }>(['video', videoId], v =>
+              v && { ...v, Likes: likes ?? v.Likes, Views: views ?? v.Views });
+            return;
+          }
+          case 'video.presence':
+            onWatching?.((data as { watching: number }).watching);
+            return;
+        }
+        if (!type.startsWith('comment.')) return;
+        const comment = data as Comment;
+        const key = listKey(comment);
+        switch (type) {
+          case 'comment.created':
+            // New top-level comments go first; replies only matter once
+            // their thread is open, so refetch it.
+            if (comment.ParentID) {
+              queryClient.invalidateQueries({ queryKey: key });
+              queryClient.setQueriesData<Pages>({ queryKey: ['comments', videoId] }, pages =>
+                updatePages(pages, cs => cs.map(c => c.ID === comment.ParentID ? { ...c, ReplyCount: c.ReplyCount + 1 } : c)));
+              return;
+            }
+            queryClient.setQueryData<Pages>(key, pages => {
+              if (!pages || pages.pages.some(p => p.comments.some(c => c.ID === comment.ID))) return pages;
+              const [first, ...rest] = pages.pages;
+              return { ...pages, pages: [{ ...first, comments: [{ ...comment, ReplyCount: 0 }, ...first.comments] }, ...rest] };
+            });
+            return;
+          case 'comment.updated':
+            queryClient.setQueryData<Pages>(key, pages =>
+              updatePages(pages, cs => cs.map(c => c.ID === comment.ID ? { ...comment, ReplyCount: c.ReplyCount } : c)));
+            return;
+          case 'comment.deleted':
+            // Comments with replies stay as a placeholder; refetch to see
+            // which way it went.
+            queryClient.invalidateQueries({ queryKey: key });
+            return;
+        }
+      };
+
+      // The server drops clients that fall behind (1013) and ones whose
+      // connection went quiet; reconnect and refetch what we missed.
+      socket.onclose = e => {
+        if (closed || (e.code !== 1013 && e.code !== 1006)) return;
+        retry = setTimeout(() => {
+          queryClient.invalidateQueries({ queryKey: ['comments', videoId] });
+          openSocket();
+        }, 2000);
       };
-      setWs(socket);
     }
     openSocket();
 
     return () => {
-      ws?.close();
+      closed = true;
+      clearTimeout(retry);
+      socket?.close();
     };
   },[videoId, auth.currentUser]);
 
@@ -58,10 +327,12 @@ export default function CommentArea({videoId}:{videoId:string}) {
     mutationFn: (newComment: { video_id: string; message: string }) => {
       return api.post('/v1/comments', newComment);
     },
-    onSuccess: () => {
+    onSuccess: res => {
       setMsg('');
+      setNotice(moderationNotice(res.status));
       queryClient.invalidateQueries({ queryKey: ['comments', videoId] });
     },
+    onError: err => setNotice(errorNotice(err)),
   });
 
   const handleSubmit = (e: React.FormEvent) => {
@@ -75,7 +346,7 @@ export default function CommentArea({videoId}:{videoId:string}) {
 
   return (
     <div className="p-4 bg-gray-100 rounded-lg">
-      <h2 className="text-lg font-bold mb-4">{comments.length} Comments</h2>
+      <h2 className="text-lg font-bold mb-4">Comments</h2>
       <form onSubmit={handleSubmit} className="mb-4">
         <textarea
           value={msg}
@@ -84,18 +355,24 @@ export default function CommentArea({videoId}:{videoId:string}) {
           placeholder={auth.currentUser ? "Add a comment..." : "Sign in to add a comment..."}
         />
         <button type="submit" className={`mt-2 px-4 py-2 rounded-lg transition-colors ${msg.trim() ? 'bg-blue-500 text-white' : 'bg-gray-300 text-gray-600'}`}>Comment</button>
+        {notice && <p className="text-sm text-gray-600 mt-1">{notice}</p>}
       </form>
+      {!!auth.currentUser && auth.currentUser.uid === ownerId && <HeldComments videoId={videoId} />}
       <div>
         {comments.map(comment => (
-          <div key={comment.ID} style={{ marginBottom: '1rem', paddingBottom: '0.5rem', borderBottom: '1px solid #e5e7eb' }}>
-            <div style={{ display: 'flex', alignItems: 'center' }}>
-              <p style={{ fontWeight: 'normal' }}>{comment.User?.Username || 'User'}</p>
-              <p style={{ color: '#6b7280', fontSize: '0.875rem', marginLeft: '1rem' }}>{new Date(comment.CreatedAt).toLocaleString([], {year: 'numeric', month: 'numeric', day: 'numeric', hour: '2-digit', minute:'2-digit'})}</p>
-            </div>
-            <p style={{ marginTop: '0' }}>{comment.Message}</p>
-          </div>
+          <CommentItem key={comment.ID} comment={comment} videoId={videoId} />
         ))}
       </div>
+      {hasNextPage && (
+        <button
+          type="button"
+          onClick={() => fetchNextPage()}
+          disabled={isFetchingNextPage}
+          className="px-4 py-2 rounded-full bg-white text-gray-900 text-sm hover:bg-gray-200 disabled:opacity-50"
+        >
+          {isFetchingNextPage ? 'Loading...' : 'More comments'}
+        </button>
+      )}
     </div>
   );
 }
@@ -91,6 +91,8 @@ export default function Header() {
               {dropdownOpen && (
                 <div className="absolute right-0 mt-2 py-2 w-48 bg-white rounded-md shadow-xl z-20">
                   <Link to="/profile" className="block px-4 py-2 text-sm text-gray-700 hover:bg-gray-100">Profile</Link>
+                  <Link to="/feed/subscriptions" className="block px-4 py-2 text-sm text-gray-700 hover:bg-gray-100">Subscriptions</Link>
+                  <Link to="/playlist/watch-later" className="block px-4 py-2 text-sm text-gray-700 hover:bg-gray-100">Watch later</Link>
                   <button onClick={handleSignOut} className="block w-full text-left px-4 py-2 text-sm text-gray-700 hover:bg-gray-100">Sign out</button>
                 </div>
               )}
@@ -0,0 +1,127 @@
+// This page shows a playlist and its videos in order. The owner can drag
+// videos to reorder them and remove them; the new order is saved one move at
+// a time by telling the backend which item the moved one now follows.
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
+import { useContext, useState } from 'react';
+import { Link, useParams } from 'react-router-dom';
+import api from '../api/axios';
+import { AuthCtx } from './AuthProvider';
+
+interface PlaylistItem {
+  ID: number;
+  VideoID: string;
+  Position: number;
+  Video: {
+    ID: string;
+    Title: string;
+    ThumbnailURL: string;
+    Views: number;
+    Likes: number;
+    User?: { Username: string };
+  };
+}
+
+interface Playlist {
+  ID: string;
+  UserID: string;
+  Title: string;
+  Description: string;
+  Visibility: 'public' | 'unlisted' | 'private';
+  Kind?: string;
+  ItemCount: number;
+  User?: { Username: string };
+  Items?: PlaylistItem[];
+}
+
+export default function PlaylistPage() {
+  const { id } = useParams<{ id: string }>();
+  const auth = useContext(AuthCtx);
+  const queryClient = useQueryClient();
+  const [dragging, setDragging] = useState<number | null>(null);
+  const { data: playlist, isLoading, error } = useQuery<Playlist>({
+    queryKey: ['playlist', id],
+    queryFn: () => api.get(`/v1/playlists/${id}`).then(res => res.data),
+    enabled: !!id && !auth?.loading,
+  });
+
+  const moveMutation = useMutation({
+    mutationFn: ({ itemId, afterItemId }: { itemId: number; afterItemId: number | null }) =>
+      api.patch(`/v1/playlists/${id}/items/${itemId}`, { afterItemId }),
+    onSettled: () => queryClient.invalidateQueries({ queryKey: ['playlist', id] }),
+  });
+  const removeMutation = useMutation({
+    mutationFn: (itemId: number) => api.delete(`/v1/playlists/${id}/items/${itemId}`),
+    onSettled: () => queryClient.invalidateQueries({ queryKey: ['playlist', id] }),
+  });
+
+  if (isLoading) return <div className="text-center p-10">Loading playlist...</div>;
+  if (error || !playlist) return <div className="text-center p-10 text-red-500">Playlist not found</div>;
+
+  const items = playlist.Items ?? [];
+  const isOwner = auth?.user?.uid === playlist.UserID;
+
+  // Dropping on an item puts the dragged one in its place: after the item
+  // before it when moving up, after the item itself when moving down.
+  const handleDrop = (target: number) => {
+    if (dragging === null || dragging === target) return;
+    const from = items.findIndex(it => it.ID === dragging);
+    const to = items.findIndex(it => it.ID === target);
+    const reordered = items.filter(it => it.ID !== dragging);
+    reordered.splice(to, 0, items[from]);
+    queryClient.setQueryData<Playlist>(['playlist', id], { ...playlist, Items: reordered });
+    const afterItemId = to === 0 ? null : reordered[to - 1].ID;
+    moveMutation.mutate({ itemId: dragging, afterItemId });
+    setDragging(null);
+  };
+
+  return (
+    <main className="flex-1 p-4 sm:p-6 max-w-4xl">
+      <h1 className="text-2xl font-bold text-gray-900">{playlist.Title}</h1>
+      <p className="text-sm text-gray-600 mt-1">
+        {playlist.User && (
+          <>
+            <Link to={`/channel/${playlist.User.Username}`} className="hover:underline">{playlist.User.Username}</Link> &bull;{' '}
+          </>
+        )}
+        {playlist.ItemCount} videos &bull; {playlist.Visibility}
+      </p>
+      {playlist.Description && <p className="text-gray-800 mt-3 whitespace-pre-line">{playlist.Description}</p>}
+
+      <ol className="mt-6 flex flex-col gap-2">
+        {items.map((item, i) => (
+          <li
+            key={item.ID}
+            draggable={isOwner}
+            onDragStart={() => setDragging(item.ID)}
+            onDragOver={e => isOwner && e.preventDefault()}
+            onDrop={() => handleDrop(item.ID)}
+            onDragEnd={() => setDragging(null)}
+            className={`flex items-center gap-3 p-2 rounded-lg hover:bg-gray-100 ${dragging === item.ID ? 'opacity-50' : ''} ${isOwner ? 'cursor-move' : ''}`}
+          >
+            <span className="w-6 text-sm text-gray-500 text-right">{i + 1}</span>
+            <Link to={`/watch/${item.Video.ID}`} className="flex items-center gap-3 flex-1 min-w-0">
+              <img src={item.Video.ThumbnailURL} alt="" className="w-40 rounded-lg object-cover aspect-video" />
+              <div className="min-w-0">
+                <p className="font-medium text-gray-900 truncate">{item.Video.Title}</p>
+                <p className="text-sm text-gray-600">
+                  {item.Video.User?.Username} &bull; {item.Video.Views} views &bull; {item.Video.Likes} likes
+                </p>
+              </div>
+            </Link>
+            {isOwner && (
+              <button
+                type="button"
+                onClick={() => removeMutation.mutate(item.ID)}
+                className="px-2 text-sm text-gray-500 hover:text-red-600"
+                aria-label={`Remove ${item.Video.Title}`}
+              >
+                Remove
+              </button>
+            )}
+          </li>
+        ))}
+      </ol>
+      {items.length === 0 && <p className="text-gray-600 mt-6">This playlist has no videos yet.</p>}
+    </main>
+  );
+}
@@ -1,4 +1,5 @@
-import { useQuery } from '@tanstack/react-query';
+import { useEffect, useState } from 'react';
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
 import api from '../api/axios';
 
 interface User {
@@ -8,11 +9,26 @@ interface User {
 }
 
 export default function ProfilePage() {
+  const queryClient = useQueryClient();
   const { data: user, isLoading, error } = useQuery<User>({ 
     queryKey: ['profile'], 
     queryFn: () => api.get('/v1/profile').then(res => res.data)
   });
 
+  // Comments on our videos that use one of these are held for review.
+  const [terms, setTerms] = useState('');
+  const blocked = useQuery<{ terms: string[] }>({
+    queryKey: ['blocked-terms'],
+    queryFn: () => api.get('/v1/profile/blocked-terms').then(res => res.data),
+  });
+  useEffect(() => {
+    if (blocked.data) setTerms(blocked.data.terms.join('\n'));
+  }, [blocked.data]);
+  const saveTerms = useMutation({
+    mutationFn: (terms: string[]) => api.put('/v1/profile/blocked-terms', { terms }),
+    onSuccess: res => queryClient.setQueryData(['blocked-terms'], res.data),
+  });
+
   if (isLoading) return <div>Loading...</div>;
   if (error) return <div>An error occurred: {error.message}</div>;
 
@@ -22,6 +38,23 @@ export default function ProfilePage() {
         <h2 className="text-xl font-bold text-black text-center">Profile</h2>
         <p className="text-black"><strong>Username:</strong> {user?.Username}</p>
         <p className="text-black"><strong>Email:</strong> {user?.Email}</p>
+        <form
+          className="mt-4"
+          onSubmit={e => { e.preventDefault(); saveTerms.mutate(terms.split('\n')); }}
+        >
+          <label className="block text-black font-bold" htmlFor="blocked-terms">Blocked words</label>
+          <p className="text-sm text-gray-700">Comments on your videos containing these words or phrases, one per line, are held for your review.</p>
+          <textarea
+            id="blocked-terms"
+            value={terms}
+            onChange={e => setTerms(e.target.value)}
+            rows={5}
+            className="w-full p-2 border rounded-lg mt-1"
+          />
+          <button type="submit" disabled={saveTerms.isPending} className="mt-1 px-3 py-1 rounded-lg bg-blue-500 text-white text-sm disabled:opacity-50">
+            {saveTerms.isSuccess && !saveTerms.isPending ? 'Saved' : 'Save'}
+          </button>
+        </form>
       </div>
     </div>
   );
@@ -1,4 +1,5 @@
-import { useQuery } from '@tanstack/react-query';
+import { useState } from 'react';
+import { useInfiniteQuery } from '@tanstack/react-query';
 import { Link } from 'react-router-dom';
 import api from '../api/axios';
 
@@ -50,16 +51,39 @@ interface Video {
   ID: string;
   Title: string;
   ThumbnailURL: string;
+  PreviewURL?: string;
   User: User;
   Views: number;
+  Likes: number;
   CreatedAt: string;
 }
 
-export default function VideoList() {
-  const { data: videos, isLoading, error } = useQuery<Video[]>({
-    queryKey: ['videos'],
-    queryFn: () => api.get('/v1/videos').then(res => res.data || []),
+interface VideoPage {
+  videos: Video[];
+  nextCursor: string;
+}
+
+const sortOptions = [
+  { value: 'newest', label: 'Newest' },
+  { value: 'trending', label: 'Trending' },
+  { value: 'views', label: 'Most viewed' },
+  { value: 'likes', label: 'Most liked' },
+  { value: 'oldest', label: 'Oldest' },
+];
+
+// endpoint is any listing that takes the GET /v1/videos parameters, such as
+// the subscription feed.
+export default function VideoList({ endpoint = '/v1/videos' }: { endpoint?: string }) {
+  const [sort, setSort] = useState('newest');
+  const [hovered, setHovered] = useState<string | null>(null);
+  const { data, isLoading, error, fetchNextPage, hasNextPage, isFetchingNextPage } = useInfiniteQuery<VideoPage>({
+    queryKey: ['videos', endpoint, sort],
+    queryFn: ({ pageParam }) =>
+      api.get(endpoint, { params: { sort, cursor: pageParam || undefined } }).then(res => res.data),
+    initialPageParam: '',
+    getNextPageParam: (lastPage) => lastPage.nextCursor || undefined,
   });
+  const videos = data?.pages.flatMap(page => page.videos);
 
   if (isLoading) {
     return <div className="text-center p-10">Loading videos...</div>;
@@ -71,11 +95,40 @@ export default function VideoList() {
 
   return (
     <main className="flex-1 p-4 sm:p-6">
+      <div className="flex gap-2 mb-6 overflow-x-auto">
+        {sortOptions.map(option => (
+          <button
+            key={option.value}
+            onClick={() => setSort(option.value)}
+            className={`px-3 py-1 rounded-lg text-sm font-medium whitespace-nowrap ${
+              sort === option.value ? 'bg-gray-900 text-white' : 'bg-gray-100 text-gray-900 hover:bg-gray-200'
+            }`}
+          >
+            {option.label}
+          </button>
+        ))}
+      </div>
       <div className="grid grid-cols-1 sm:grid-cols-2 md:grid-cols-3 lg:grid-cols-4 xl:grid-cols-5 gap-x-4 gap-y-8">
         {videos?.map(video => (
-          <Link to={`/watch/${video.ID}`} key={video.ID} className="flex flex-col">
+          <Link
+            to={`/watch/${video.ID}`}
+            key={video.ID}
+            className="flex flex-col"
+            onMouseEnter={() => setHovered(video.ID)}
+            onMouseLeave={() => setHovered(null)}
+          >
             <div className="relative">
               <img src={video.ThumbnailURL} alt={video.Title} className="w-full h-auto rounded-xl object-cover aspect-video" />
+              {hovered === video.ID && video.PreviewURL && (
+                <video
+                  src={video.PreviewURL}
+                  autoPlay
+                  muted
+                  loop
+                  playsInline
+                  className="absolute inset-0 w-full h-full rounded-xl object-cover"
+                />
+              )}
               {/* Duration can be added here if available in the model */}
             </div>
             <div className="flex items-start mt-3">
@@ -91,6 +144,17 @@ export default function VideoList() {
           </Link>
         ))}
       </div>
+      {hasNextPage && (
+        <div className="flex justify-center mt-8">
+          <button
+            onClick={() => fetchNextPage()}
+            disabled={isFetchingNextPage}
+            className="px-4 py-2 rounded-full bg-gray-100 text-gray-900 text-sm hover:bg-gray-200 disabled:opacity-50"
+          >
+            {isFetchingNextPage ? 'Loading...' : 'Load more'}
+          </button>
+        </div>
+      )}
     </main>
   );
 }
@@ -3,8 +3,8 @@
 // showing the title and description, and including the comment section.
 import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
 import api from '../api/axios';
-import { useContext, useEffect, useRef } from 'react';
-import { useParams } from 'react-router-dom';
+import { useContext, useEffect, useRef, useState } from 'react';
+import { Link, useParams } from 'react-router-dom';
 
 import VideoPlayer from './VideoPlayer';
 import CommentArea from './CommentArea';
@@ -12,9 +12,11 @@ import { AuthCtx } from './AuthProvider';
 
 interface Video {
   ID: string;
+  UserID: string;
   Title: string;
   Description: string;
   ObjectName: string;
+  PlaylistURL?: string;
   User: {
     Username: string;
   };
@@ -31,6 +33,7 @@ export default function VideoPage() {
   const queryClient = useQueryClient();
   const viewIncremented = useRef(false);
   const auth = useContext(AuthCtx);
+  const [watching, setWatching] = useState(0);
 
   const { data: video, isLoading, error } = useQuery<Video>({
     queryKey: ['video', id],
@@ -51,6 +54,21 @@ export default function VideoPage() {
     },
   });
 
+  const watchLaterMutation = useMutation({
+    mutationFn: () => api.post('/v1/playlists/watch-later/items', { videoId: id }),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ['playlist', 'watch-later'] });
+    },
+  });
+
+  const handleWatchLater = () => {
+    if (!auth?.user) {
+      alert('You are not logged in');
+      return;
+    }
+    watchLaterMutation.mutate();
+  };
+
   const handleLike = () => {
     if (!auth?.user) {
       alert('You are not logged in');
@@ -80,7 +98,7 @@ export default function VideoPage() {
   if (error) return <div>An error occurred: {error.message}</div>;
   if (!video) return <div>Video not found</div>;
 
-  const videoSrc = `${import.meta.env.VITE_GCS_URL}/${video.ObjectName}`;
+  const videoSrc = video.PlaylistURL || `${import.meta.env.VITE_GCS_URL}/${video.ObjectName}`;
 
   return (
     <div className="container mx-auto p-4 max-w-4xl w-full">
@@ -91,7 +109,9 @@ export default function VideoPage() {
           <div className="mt-4">
             <h1 className="text-2xl font-bold">{video.Title}</h1>
             <div style={{ display: 'flex', alignItems: 'center', gap: '1rem' }} className="mt-2">
-              <div className="text-gray-600">Uploaded by {video.User.Username}</div>
+              <div className="text-gray-600">
+                Uploaded by <Link to={`/channel/${video.User.Username}`} className="hover:underline">{video.User.Username}</Link>
+              </div>
               <div className="like-wrapper">
                 <button 
                   className={`container star-button ${video.IsLiked && auth?.user ? 'liked' : ''}`}
@@ -105,10 +125,18 @@ export default function VideoPage() {
                   </svg>
                 </button>
               </div>
+              <button
+                type="button"
+                onClick={handleWatchLater}
+                disabled={watchLaterMutation.isPending || watchLaterMutation.isSuccess}
+                className="px-3 py-1 rounded-full bg-gray-100 text-sm text-gray-900 hover:bg-gray-200 disabled:opacity-60"
+              >
+                {watchLaterMutation.isSuccess ? 'Saved to Watch later' : 'Watch later'}
+              </button>
             </div>
 
             <div className="mt-4 p-4 bg-gray-100 rounded-lg">
-              <p className="text-sm font-medium text-gray-700 mb-1">{video.Views.toLocaleString()} views • Uploaded {new Date(video.CreatedAt).toLocaleDateString('en-US', { month: 'short', day: 'numeric', year: 'numeric' })}</p>
+              <p className="text-sm font-medium text-gray-700 mb-1">{video.Views.toLocaleString()} views{watching > 0 && ` • ${watching.toLocaleString()} watching now`} • Uploaded {new Date(video.CreatedAt).toLocaleDateString('en-US', { month: 'short', day: 'numeric', year: 'numeric' })}</p>
               <p className="text-base whitespace-pre-wrap">{video.Description}</p>
             </div>
             {video.Summary && (
@@ -120,7 +148,7 @@ export default function VideoPage() {
           </div>
         </div>
         <div>
-          <CommentArea videoId={video.ID} />
+          <CommentArea videoId={video.ID} ownerId={video.UserID} onWatching={setWatching} />
         </div>
       </div>
     </div>
@@ -1,8 +1,24 @@
 import { useEffect, useRef } from 'react';
+import Hls from 'hls.js';
 
 export default function VideoPlayer({ src, autoPlay }: { src: string, autoPlay?: boolean }) {
   const videoRef = useRef<HTMLVideoElement>(null);
 
+  // HLS playlists go through hls.js where Media Source Extensions exist;
+  // otherwise (iOS Safari) the browser plays the .m3u8 natively via `src`.
+  const useHls = src.endsWith('.m3u8') && Hls.isSupported();
+
+  useEffect(() => {
+    const video = videoRef.current;
+    if (!video || !useHls) {
+      return;
+    }
+    const hls = new Hls();
+    hls.loadSource(src);
+    hls.attachMedia(video);
+    return () => hls.destroy();
+  }, [src, useHls]);
+
   useEffect(() => {
     if (autoPlay && videoRef.current) {
       const playVideo = async () => {
@@ -27,7 +43,7 @@ export default function VideoPlayer({ src, autoPlay }: { src: string, autoPlay?:
 
   return (
     // The `muted` attribute is removed from here to allow the initial attempt to play with sound.
-    <video ref={videoRef} controls src={src} className="w-full rounded-lg" playsInline>
+    <video ref={videoRef} controls src={useHls ? undefined : src} className="w-full rounded-lg" playsInline>
       Your browser does not support the video tag.
     </video>
   );
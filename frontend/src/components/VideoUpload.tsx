@@ -10,6 +10,8 @@ export default function VideoUpload() {
   const [file, setFile] = useState<File | null>(null);
   const [title, setTitle] = useState('');
   const [desc, setDesc] = useState('');
+  const [visibility, setVisibility] = useState('public');
+  const [publishAt, setPublishAt] = useState('');
   const [isUploading, setIsUploading] = useState(false);
   const [uploadStatus, setUploadStatus] = useState('');
   const [error, setError] = useState<string | null>(null);
@@ -47,6 +49,10 @@ export default function VideoUpload() {
       setError('Please provide a video description.');
       return;
     }
+    if (visibility === 'scheduled' && !publishAt) {
+      setError('Please choose when the video should be published.');
+      return;
+    }
 
     setIsUploading(true);
     setError(null);
@@ -75,6 +81,9 @@ export default function VideoUpload() {
         objectName: objectName,
         title: title,
         description: desc,
+        visibility,
+        // datetime-local has no zone; the browser's is the one the user meant
+        publishAt: visibility === 'scheduled' ? new Date(publishAt).toISOString() : undefined,
       });
 
       setUploadStatus('Upload complete!');
@@ -115,6 +124,15 @@ export default function VideoUpload() {
         </label>
         <input className="w-full p-2 border rounded-lg" placeholder="Title" value={title} onChange={e => setTitle(e.target.value)} />
         <textarea className="w-full p-2 border rounded-lg" placeholder="Description" value={desc} onChange={e => setDesc(e.target.value)} />
+        <select className="w-full p-2 border rounded-lg" value={visibility} onChange={e => setVisibility(e.target.value)}>
+          <option value="public">Public</option>
+          <option value="unlisted">Unlisted - anyone with the link</option>
+          <option value="private">Private - only you</option>
+          <option value="scheduled">Scheduled</option>
+        </select>
+        {visibility === 'scheduled' && (
+          <input type="datetime-local" className="w-full p-2 border rounded-lg" value={publishAt} onChange={e => setPublishAt(e.target.value)} />
+        )}
         <div className="flex flex-col items-center">
           <button className={`px-4 py-2 rounded-lg transition-colors ${file ? 'bg-blue-500 text-white' : 'bg-gray-100 text-gray-500'}`} disabled={!file || isUploading}>
             {isUploading ? 'Uploading...' : 'Upload'}
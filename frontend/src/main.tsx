@@ -14,6 +14,8 @@ import ProtectedRoute from './components/ProtectedRoute';
 import RedirectIfAuth from './components/RedirectIfAuth';
 import Layout from './components/Layout';
 import ProfilePage from './components/ProfilePage';
+import ChannelPage from './components/ChannelPage';
+import PlaylistPage from './components/PlaylistPage';
 import VideoList from './components/VideoList';
 import VideoUpload from './components/VideoUpload';
 import VideoPage from './components/VideoPage';
@@ -54,6 +56,24 @@ ReactDOM.createRoot(document.getElementById('root')!).render(
               path="/watch/:id"
               element={<Layout><VideoPage /></Layout>}
             />
+            <Route
+              path="/feed/subscriptions"
+              element={
+                <ProtectedRoute>
+                  <Layout>
+                    <VideoList endpoint="/v1/feed/subscriptions" />
+                  </Layout>
+                </ProtectedRoute>
+              }
+            />
+            <Route
+              path="/channel/:username"
+              element={<Layout><ChannelPage /></Layout>}
+            />
+            <Route
+              path="/playlist/:id"
+              element={<Layout><PlaylistPage /></Layout>}
+            />
             <Route
               path="/profile"
               element={